@@ -0,0 +1,180 @@
+package aiprobe
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+var namespace string = "blueiris"
+
+//go:embed probe.jpg
+var defaultImage []byte
+
+var (
+	successDesc  = newDesc("ai_probe_success", "Whether the last synthetic AI detection succeeded")
+	durationDesc = newDesc("ai_probe_duration_seconds", "Duration of the last synthetic AI detection")
+	objectsDesc  = newDesc("ai_probe_objects", "Count of objects returned by the last synthetic AI detection")
+	lastDesc     = newDesc("ai_probe_last_run_timestamp_seconds", "Unix time of the last synthetic AI detection")
+)
+
+func newDesc(name string, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil)
+}
+
+type result struct {
+	success  bool
+	duration float64
+	objects  float64
+	time     time.Time
+}
+
+// Prober periodically posts a test image to a DeepStack or CodeProject.AI
+// compatible /v1/vision/detection endpoint.
+type Prober struct {
+	url        string
+	image      []byte
+	minObjects int
+	timeout    time.Duration
+	http       *http.Client
+
+	mutex sync.RWMutex
+	last  result
+}
+
+func NewProber(url string, imagePath string, minObjects int, timeout time.Duration) (*Prober, error) {
+	image := defaultImage
+	if imagePath != "" {
+		var err error
+		image, err = os.ReadFile(imagePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading AI probe image %v: %v", imagePath, err)
+		}
+	}
+
+	return &Prober{
+		url:        strings.TrimSuffix(url, "/") + "/v1/vision/detection",
+		image:      image,
+		minObjects: minObjects,
+		timeout:    timeout,
+		http:       &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (p *Prober) Run(interval time.Duration) {
+	for {
+		p.probe()
+		time.Sleep(interval)
+	}
+}
+
+func (p *Prober) probe() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	objects, err := p.detect(ctx)
+	r := result{
+		success:  err == nil,
+		duration: time.Since(start).Seconds(),
+		objects:  float64(objects),
+		time:     start,
+	}
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("AI probe - Detection failed. Error: %v", err), "console")
+	}
+
+	p.mutex.Lock()
+	p.last = r
+	p.mutex.Unlock()
+}
+
+func (p *Prober) detect(ctx context.Context) (int, error) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("image", "probe.jpg")
+	if err != nil {
+		return 0, err
+	}
+	_, err = part.Write(p.image)
+	if err != nil {
+		return 0, err
+	}
+	err = w.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	res, err := p.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code %v from %v", res.StatusCode, p.url)
+	}
+
+	var detection struct {
+		Success     bool          `json:"success"`
+		Error       string        `json:"error"`
+		Predictions []interface{} `json:"predictions"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&detection)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding response from %v: %v", p.url, err)
+	}
+	if !detection.Success {
+		if detection.Error == "" {
+			return 0, errors.New("detection was not successful")
+		}
+		return 0, errors.New(detection.Error)
+	}
+	if len(detection.Predictions) < p.minObjects {
+		return len(detection.Predictions), fmt.Errorf("found %v objects, expected at least %v", len(detection.Predictions), p.minObjects)
+	}
+	return len(detection.Predictions), nil
+}
+
+func (p *Prober) Describe(ch chan<- *prometheus.Desc) {
+	ch <- successDesc
+	ch <- durationDesc
+	ch <- objectsDesc
+	ch <- lastDesc
+}
+
+func (p *Prober) Collect(ch chan<- prometheus.Metric) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.last.time.IsZero() {
+		return
+	}
+
+	success := 0.0
+	if p.last.success {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(successDesc, prometheus.GaugeValue, success)
+	ch <- prometheus.MustNewConstMetric(durationDesc, prometheus.GaugeValue, p.last.duration)
+	ch <- prometheus.MustNewConstMetric(objectsDesc, prometheus.GaugeValue, p.last.objects)
+	ch <- prometheus.MustNewConstMetric(lastDesc, prometheus.GaugeValue, float64(p.last.time.Unix()))
+}
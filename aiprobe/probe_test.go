@@ -0,0 +1,72 @@
+package aiprobe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		minObjects int
+		success    float64
+		objects    float64
+	}{
+		{"success", http.StatusOK, `{"success": true, "predictions": [{"label": "person", "confidence": 0.87}]}`, 1, 1, 1},
+		{"no objects needed", http.StatusOK, `{"success": true, "predictions": []}`, 0, 1, 0},
+		{"server error", http.StatusInternalServerError, `{"success": false}`, 0, 0, 0},
+		{"detection failed", http.StatusOK, `{"success": false, "error": "No module found"}`, 0, 0, 0},
+		{"too few objects", http.StatusOK, `{"success": true, "predictions": [{"label": "person", "confidence": 0.87}]}`, 2, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/vision/detection" {
+					t.Errorf("request to %v", r.URL.Path)
+				}
+				f, _, err := r.FormFile("image")
+				if err != nil {
+					t.Errorf("no image: %v", err)
+				} else if image, _ := io.ReadAll(f); !bytes.Equal(image, defaultImage) {
+					t.Errorf("image is not the bundled one")
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer s.Close()
+
+			p, err := NewProber(s.URL+"/", "", tt.minObjects, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testutil.CollectAndCount(p) != 0 {
+				t.Error("metrics before the first detection")
+			}
+			p.probe()
+
+			want := `
+# HELP blueiris_ai_probe_objects Count of objects returned by the last synthetic AI detection
+# TYPE blueiris_ai_probe_objects gauge
+blueiris_ai_probe_objects ` + fmt.Sprint(tt.objects) + `
+# HELP blueiris_ai_probe_success Whether the last synthetic AI detection succeeded
+# TYPE blueiris_ai_probe_success gauge
+blueiris_ai_probe_success ` + fmt.Sprint(tt.success) + `
+`
+			err = testutil.CollectAndCompare(p, strings.NewReader(want), "blueiris_ai_probe_success", "blueiris_ai_probe_objects")
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+const (
+	CameraDown        = "BlueIrisCameraDown"
+	AIFailing         = "BlueIrisAIFailing"
+	FolderDiskFreeLow = "BlueIrisFolderDiskFreeLow"
+	LogStale          = "BlueIrisLogStale"
+)
+
+var alertNames = []string{CameraDown, AIFailing, FolderDiskFreeLow, LogStale}
+
+// The names of the rules in the disable option.
+const (
+	ruleCameraDown     = "camera_down"
+	ruleAIFailing      = "ai_failing"
+	ruleFolderDiskFree = "folder_disk_free"
+	ruleLogStale       = "log_stale"
+)
+
+// Alerter evaluates the built-in alert conditions on the parser state and
+// sends the firing alerts to Alertmanager, like Prometheus does for its
+// rules. Firing alerts are sent again every interval and resolved alerts
+// once, with their end time.
+type Alerter struct {
+	url          string
+	client       *http.Client
+	logpath      string
+	interval     time.Duration
+	labels       map[string]string
+	generatorURL string
+	disabled     map[string]bool
+
+	cameraDownFor time.Duration
+	aiFailingFor  time.Duration
+	diskFreeBelow float64
+	logStaleFor   time.Duration
+
+	active   map[string]*alert
+	resolved map[string]*alert
+
+	firing   *prometheus.GaugeVec
+	sent     prometheus.Counter
+	failures prometheus.Counter
+}
+
+type alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func NewAlerter(c config.Alertmanager, logpath string) *Alerter {
+	labels := map[string]string{"job": "blueiris_exporter"}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["instance"] = hostname
+	}
+	for k, v := range c.Labels {
+		labels[k] = v
+	}
+
+	a := &Alerter{
+		url:           strings.TrimSuffix(c.URL, "/") + "/api/v2/alerts",
+		client:        c.HTTPClient.NewClient(),
+		logpath:       logpath,
+		interval:      c.Interval,
+		labels:        labels,
+		generatorURL:  c.GeneratorURL,
+		disabled:      make(map[string]bool),
+		cameraDownFor: c.CameraDownFor,
+		aiFailingFor:  c.AIFailingFor,
+		diskFreeBelow: c.FolderDiskFreeBelowGB * 1000 * 1000 * 1000,
+		logStaleFor:   c.LogStaleFor,
+		active:        make(map[string]*alert),
+		resolved:      make(map[string]*alert),
+		firing: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "alertmanager_alerts_firing",
+			Help:      "Count of built-in alerts firing",
+		}, []string{"alertname"}),
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "alertmanager_notifications_total",
+			Help:      "Count of requests sent to Alertmanager",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "alertmanager_notification_failures_total",
+			Help:      "Count of failed requests to Alertmanager",
+		}),
+	}
+	for _, rule := range c.Disable {
+		a.disabled[rule] = true
+	}
+	for _, name := range alertNames {
+		a.firing.WithLabelValues(name)
+	}
+	return a
+}
+
+func (a *Alerter) Run() {
+	for {
+		a.evaluate()
+		time.Sleep(a.interval)
+	}
+}
+
+func (a *Alerter) evaluate() {
+	s, err := blueiris.Snapshot(a.logpath)
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("Alertmanager - Error reading the log. Error: %v", err), "console")
+		return
+	}
+	a.update(s, time.Now())
+	a.send()
+}
+
+// update evaluates the rules on the state at now, keeping the start time of
+// the alerts that were already firing and resolving the ones that stopped.
+func (a *Alerter) update(s blueiris.State, now time.Time) {
+	firing := make(map[string]*alert)
+	add := func(labels map[string]string, summary string, description string) {
+		al := &alert{
+			Labels:       make(map[string]string),
+			Annotations:  map[string]string{"summary": summary, "description": description},
+			GeneratorURL: a.generatorURL,
+		}
+		for k, v := range a.labels {
+			al.Labels[k] = v
+		}
+		for k, v := range labels {
+			al.Labels[k] = v
+		}
+		firing[fingerprint(al.Labels)] = al
+	}
+
+	if !a.disabled[ruleCameraDown] {
+		for _, c := range s.Cameras {
+			if c.State == blueiris.CameraNoSignal && c.Since != nil && now.Sub(*c.Since) >= a.cameraDownFor {
+				add(map[string]string{"alertname": CameraDown, "severity": "critical", "camera": c.Name},
+					fmt.Sprintf("Camera %v is down", c.Name),
+					fmt.Sprintf("Camera %v has had no signal since %v: %v", c.Name, c.Since.Format(time.RFC3339), c.Detail))
+			}
+		}
+	}
+	if !a.disabled[ruleAIFailing] {
+		for _, p := range s.AI {
+			if p.State == blueiris.AIFailing && p.Since != nil && now.Sub(*p.Since) >= a.aiFailingFor {
+				add(map[string]string{"alertname": AIFailing, "severity": "critical", "ai_provider": p.Provider},
+					fmt.Sprintf("AI provider %v is failing", p.Provider),
+					fmt.Sprintf("AI provider %v has been failing since %v", p.Provider, p.Since.Format(time.RFC3339)))
+			}
+		}
+	}
+	if !a.disabled[ruleFolderDiskFree] {
+		for _, f := range s.Folders {
+			if f.DiskFree < a.diskFreeBelow {
+				add(map[string]string{"alertname": FolderDiskFreeLow, "severity": "warning", "folder": f.Name},
+					fmt.Sprintf("Disk of folder %v is almost full", f.Name),
+					fmt.Sprintf("The disk of folder %v has %.1f GB free", f.Name, f.DiskFree/1000/1000/1000))
+			}
+		}
+	}
+	// Until a line has been read there is nothing to tell how old the log
+	// is.
+	if !a.disabled[ruleLogStale] && !s.LastLine.IsZero() && now.Sub(s.LastLine) >= a.logStaleFor {
+		add(map[string]string{"alertname": LogStale, "severity": "critical"},
+			"Blue Iris stopped writing its log",
+			fmt.Sprintf("The last Blue Iris log line was written at %v", s.LastLine.Format(time.RFC3339)))
+	}
+
+	for key, al := range firing {
+		if prev, ok := a.active[key]; ok {
+			al.StartsAt = prev.StartsAt
+		} else {
+			al.StartsAt = now
+		}
+		// Like Prometheus, let the alert expire in Alertmanager if the
+		// exporter stops sending it.
+		al.EndsAt = now.Add(4 * a.interval)
+		delete(a.resolved, key)
+	}
+	for key, al := range a.active {
+		if _, ok := firing[key]; !ok {
+			al.EndsAt = now
+			a.resolved[key] = al
+		}
+	}
+	a.active = firing
+
+	counts := make(map[string]float64)
+	for _, al := range a.active {
+		counts[al.Labels["alertname"]]++
+	}
+	for _, name := range alertNames {
+		a.firing.WithLabelValues(name).Set(counts[name])
+	}
+}
+
+// send posts the firing and resolved alerts. Resolved alerts are kept until
+// Alertmanager accepted them.
+func (a *Alerter) send() {
+	alerts := make([]*alert, 0, len(a.active)+len(a.resolved))
+	for _, al := range a.active {
+		alerts = append(alerts, al)
+	}
+	for _, al := range a.resolved {
+		alerts = append(alerts, al)
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	a.sent.Inc()
+	err := a.post(alerts)
+	if err != nil {
+		a.failures.Inc()
+		common.BIlogger(fmt.Sprintf("Alertmanager - Error sending alerts. Error: %v", err), "console")
+		return
+	}
+	a.resolved = make(map[string]*alert)
+}
+
+func (a *Alerter) post(alerts []*alert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Failed requests aren't retried, the alerts are sent again at the next
+	// interval.
+	_, err = config.Send(a.client, req)
+	return err
+}
+
+func fingerprint(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\xff")
+}
+
+func (a *Alerter) Describe(ch chan<- *prometheus.Desc) {
+	a.firing.Describe(ch)
+	ch <- a.sent.Desc()
+	ch <- a.failures.Desc()
+}
+
+func (a *Alerter) Collect(ch chan<- prometheus.Metric) {
+	a.firing.Collect(ch)
+	ch <- a.sent
+	ch <- a.failures
+}
@@ -0,0 +1,195 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+)
+
+func newTestAlerter(url string, disable ...string) *Alerter {
+	return NewAlerter(config.Alertmanager{
+		URL:                   url + "/",
+		Interval:              time.Minute,
+		Labels:                map[string]string{"site": "home"},
+		CameraDownFor:         5 * time.Minute,
+		AIFailingFor:          5 * time.Minute,
+		FolderDiskFreeBelowGB: 10,
+		LogStaleFor:           15 * time.Minute,
+		Disable:               disable,
+		HTTPClient:            config.HTTPClient{Timeout: 5 * time.Second},
+	}, "")
+}
+
+// next returns the alerts of the next request.
+func next(t *testing.T, requests chan configtest.Request) []alert {
+	t.Helper()
+	r := configtest.Next(t, requests)
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v2/alerts" {
+		t.Errorf("unexpected request %v %v", r.Method, r.URL)
+	}
+	var alerts []alert
+	err := json.Unmarshal(r.Body, &alerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alerts
+}
+
+// names returns the alert names with the label that tells them apart.
+func names(alerts []alert) string {
+	var names []string
+	for _, al := range alerts {
+		names = append(names, strings.TrimSpace(al.Labels["alertname"]+" "+al.Labels["camera"]+al.Labels["ai_provider"]+al.Labels["folder"]))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+var at = time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func cameraDown(since time.Time) blueiris.State {
+	return blueiris.State{
+		Cameras:  []blueiris.CameraStatus{{Name: "Drive", State: blueiris.CameraNoSignal, Detail: "network", Since: timePtr(since)}},
+		LastLine: at,
+	}
+}
+
+func TestAlerterInterval(t *testing.T) {
+	server, requests := configtest.NewServer(t)
+	a := newTestAlerter(server.URL)
+
+	a.update(cameraDown(at.Add(-10*time.Minute)), at)
+	a.send()
+	alerts := next(t, requests)
+	if len(alerts) != 1 {
+		t.Fatalf("got %v alerts, want 1: %+v", len(alerts), alerts)
+	}
+	al := alerts[0]
+	for k, want := range map[string]string{"alertname": CameraDown, "severity": "critical", "camera": "Drive", "job": "blueiris_exporter", "site": "home"} {
+		if al.Labels[k] != want {
+			t.Errorf("label %v is %q, want %q", k, al.Labels[k], want)
+		}
+	}
+	if want := "Camera Drive has had no signal since 2026-10-19T14:50:00Z: network"; al.Annotations["description"] != want {
+		t.Errorf("description is %q, want %q", al.Annotations["description"], want)
+	}
+	if !al.StartsAt.Equal(at) || !al.EndsAt.Equal(at.Add(4*time.Minute)) {
+		t.Errorf("alert from %v to %v, want from %v to 4 intervals later", al.StartsAt, al.EndsAt, at)
+	}
+	if v := testutil.ToFloat64(a.firing.WithLabelValues(CameraDown)); v != 1 {
+		t.Errorf("%v firing, want 1", v)
+	}
+
+	// A firing alert keeps its start time, its end time moves on.
+	a.update(cameraDown(at.Add(-10*time.Minute)), at.Add(time.Minute))
+	a.send()
+	al = next(t, requests)[0]
+	if !al.StartsAt.Equal(at) || !al.EndsAt.Equal(at.Add(5*time.Minute)) {
+		t.Errorf("alert from %v to %v, want from %v to 4 intervals later", al.StartsAt, al.EndsAt, at)
+	}
+
+	// A resolved alert is sent once, ending when it was resolved.
+	up := blueiris.State{Cameras: []blueiris.CameraStatus{{Name: "Drive", State: blueiris.CameraUp}}, LastLine: at}
+	a.update(up, at.Add(2*time.Minute))
+	a.send()
+	al = next(t, requests)[0]
+	if !al.StartsAt.Equal(at) || !al.EndsAt.Equal(at.Add(2*time.Minute)) {
+		t.Errorf("resolved alert from %v to %v, want from %v to %v", al.StartsAt, al.EndsAt, at, at.Add(2*time.Minute))
+	}
+	if v := testutil.ToFloat64(a.firing.WithLabelValues(CameraDown)); v != 0 {
+		t.Errorf("%v firing after the resolve, want 0", v)
+	}
+	a.update(up, at.Add(3*time.Minute))
+	a.send()
+	configtest.None(t, requests)
+}
+
+func TestAlerterResolvedRetry(t *testing.T) {
+	server, requests := configtest.NewServer(t, http.StatusNoContent, http.StatusInternalServerError)
+	a := newTestAlerter(server.URL)
+	up := blueiris.State{LastLine: at}
+
+	a.update(cameraDown(at.Add(-10*time.Minute)), at)
+	a.send()
+	next(t, requests)
+
+	// The resolved alert is sent again after the failed request, with the
+	// time it was resolved.
+	a.update(up, at.Add(time.Minute))
+	a.send()
+	next(t, requests)
+	a.update(up, at.Add(2*time.Minute))
+	a.send()
+	alerts := next(t, requests)
+	if len(alerts) != 1 || !alerts[0].EndsAt.Equal(at.Add(time.Minute)) {
+		t.Errorf("got %+v, want the alert resolved at %v", alerts, at.Add(time.Minute))
+	}
+	a.update(up, at.Add(3*time.Minute))
+	a.send()
+	configtest.None(t, requests)
+
+	if v := testutil.ToFloat64(a.sent); v != 3 {
+		t.Errorf("%v requests sent, want 3", v)
+	}
+	if v := testutil.ToFloat64(a.failures); v != 1 {
+		t.Errorf("%v requests failed, want 1", v)
+	}
+}
+
+func TestAlerterRules(t *testing.T) {
+	state := blueiris.State{
+		Cameras: []blueiris.CameraStatus{
+			{Name: "Drive", State: blueiris.CameraNoSignal, Since: timePtr(at.Add(-10 * time.Minute))},
+			{Name: "Gate", State: blueiris.CameraNoSignal, Since: timePtr(at.Add(-time.Minute))},
+			{Name: "Porch", State: blueiris.CameraUp, Since: timePtr(at.Add(-time.Hour))},
+		},
+		AI: []blueiris.AIProviderStatus{
+			{Provider: "CodeProject.AI", State: blueiris.AIFailing, Since: timePtr(at.Add(-10 * time.Minute))},
+			{Provider: "DeepStack", State: blueiris.AIFailing, Since: timePtr(at.Add(-time.Minute))},
+		},
+		Folders: []blueiris.FolderStatus{
+			{Name: "New", DiskFree: 5e9},
+			{Name: "Stored", DiskFree: 50e9},
+		},
+		LastLine: at.Add(-20 * time.Minute),
+	}
+	noLine := state
+	noLine.LastLine = time.Time{}
+
+	tests := []struct {
+		name    string
+		state   blueiris.State
+		disable []string
+		want    string
+	}{
+		{"all rules", state, nil, "BlueIrisAIFailing CodeProject.AI, BlueIrisCameraDown Drive, BlueIrisFolderDiskFreeLow New, BlueIrisLogStale"},
+		{"disabled", state, []string{ruleCameraDown, ruleLogStale}, "BlueIrisAIFailing CodeProject.AI, BlueIrisFolderDiskFreeLow New"},
+		{"all disabled", state, []string{ruleCameraDown, ruleAIFailing, ruleFolderDiskFree, ruleLogStale}, ""},
+		{"no line read", noLine, nil, "BlueIrisAIFailing CodeProject.AI, BlueIrisCameraDown Drive, BlueIrisFolderDiskFreeLow New"},
+	}
+	for _, tt := range tests {
+		server, requests := configtest.NewServer(t)
+		a := newTestAlerter(server.URL, tt.disable...)
+		a.update(tt.state, at)
+		a.send()
+		if tt.want == "" {
+			configtest.None(t, requests)
+			continue
+		}
+		if got := names(next(t, requests)); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
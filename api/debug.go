@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+)
+
+// LineHandler returns the log line with the line_hash of an
+// ai_duration_seconds exemplar, e.g. /debug/line?hash=9f2c4e1a07b3d588.
+func LineHandler(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		http.Error(w, "hash is required", http.StatusBadRequest)
+		return
+	}
+	line, ok := blueiris.LineByHash(hash)
+	if !ok {
+		http.Error(w, "no line with hash "+hash, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(line + "\n"))
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"testing"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+)
+
+func TestLineHandler(t *testing.T) {
+	_, err := blueiris.Snapshot(logPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := fixture[5]
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	hash := fmt.Sprintf("%016x", h.Sum64())
+
+	tests := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"?hash=" + hash, http.StatusOK, line + "\n"},
+		{"?hash=0000000000000000", http.StatusNotFound, "no line with hash 0000000000000000\n"},
+		{"", http.StatusBadRequest, "hash is required\n"},
+	}
+	for _, tt := range tests {
+		w := get(t, http.HandlerFunc(LineHandler), http.MethodGet, "/debug/line"+tt.query)
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%q: got %v %q, want %v %q", tt.query, w.Code, w.Body, tt.status, tt.body)
+		}
+	}
+}
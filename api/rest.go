@@ -0,0 +1,99 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+// Version is the version of the JSON responses. Fields are only added within
+// a version.
+const Version = "v1"
+
+//go:embed openapi.json
+var openAPI []byte
+
+type handler struct {
+	logpath string
+	mux     *http.ServeMux
+}
+
+// NewHandler serves the read-only JSON API under /api/v1/, with the current
+// version also served without the version prefix, and its OpenAPI document on
+// /api/openapi.json.
+func NewHandler(logpath string) http.Handler {
+	h := &handler{logpath: logpath, mux: http.NewServeMux()}
+	for _, prefix := range []string{"/api/", "/api/" + Version + "/"} {
+		h.mux.HandleFunc(prefix+"cameras", h.serve(func(s blueiris.State) interface{} {
+			return cameras{Version, s.Cameras}
+		}))
+		h.mux.HandleFunc(prefix+"folders", h.serve(func(s blueiris.State) interface{} {
+			return folders{Version, s.Folders}
+		}))
+		h.mux.HandleFunc(prefix+"ai", h.serve(func(s blueiris.State) interface{} {
+			return ai{Version, s.AI, s.Alerts}
+		}))
+		h.mux.HandleFunc(prefix+"profile", h.serve(func(s blueiris.State) interface{} {
+			return profile{Version, s.Profile}
+		}))
+	}
+	h.mux.HandleFunc("/api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+	return h.mux
+}
+
+type cameras struct {
+	Version string                  `json:"api_version"`
+	Cameras []blueiris.CameraStatus `json:"cameras"`
+}
+
+type folders struct {
+	Version string                  `json:"api_version"`
+	Folders []blueiris.FolderStatus `json:"folders"`
+}
+
+type ai struct {
+	Version   string                      `json:"api_version"`
+	Providers []blueiris.AIProviderStatus `json:"providers"`
+	Alerts    []blueiris.AIAlert          `json:"alerts"`
+}
+
+type profile struct {
+	Version string `json:"api_version"`
+	blueiris.ProfileStatus
+}
+
+type apiError struct {
+	Version string `json:"api_version"`
+	Error   string `json:"error"`
+}
+
+func (h *handler) serve(body func(blueiris.State) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{Version, "method not allowed"})
+			return
+		}
+
+		s, err := blueiris.Snapshot(h.logpath)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("API - Error reading the log. Error: %v", err), "console")
+			writeJSON(w, http.StatusServiceUnavailable, apiError{Version, err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, body(s))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
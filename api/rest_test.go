@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the files in testdata")
+
+// fixture is a log the API is read from. The parser keeps its state in the
+// blueiris package, so all the tests of the package read the same log.
+var fixture = []string{
+	"Blue Iris log",
+	"0 \t10/19/2026 2:59:59.000 PM\tApp           Current profile: 1",
+	"0 \t10/19/2026 3:00:00.000 PM\tApp           Current profile: 2",
+	"0 \t10/19/2026 3:00:01.000 PM\tCodeProject.AI: has been started",
+	"0 \t10/19/2026 3:00:02.000 PM\tFrontDoor     MOTION",
+	"0 \t10/19/2026 3:00:03.000 PM\tFrontDoor     CodeProject.AI: [ipcam-combined] person:87% [12,40 180,320] 123ms",
+	"0 \t10/19/2026 3:00:04.000 PM\tDrive         EXTERNAL",
+	"0 \t10/19/2026 3:00:05.000 PM\tDrive         CodeProject.AI: [ipcam-combined] car:91% [0,0 640,480] 45ms",
+	"1 \t10/19/2026 3:00:06.000 PM\tDrive         Signal: network retry",
+	"0 \t10/19/2026 3:00:07.000 PM\tNew           Delete: 5 items 1.5G [24/168 hrs, 120.5G/500G, 250.3G free]",
+	"2 \t10/19/2026 3:00:08.000 PM\tCodeProject.AI: timeout",
+	"0 \t10/19/2026 3:00:38.000 PM\tCodeProject.AI: has been restarted",
+}
+
+var (
+	fixtureOnce sync.Once
+	fixturePath string
+	fixtureErr  error
+)
+
+// logPath returns the directory of the fixture log.
+func logPath(t *testing.T) string {
+	t.Helper()
+	fixtureOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "api")
+		if err != nil {
+			fixtureErr = err
+			return
+		}
+		fixturePath = dir + string(filepath.Separator)
+		fixtureErr = os.WriteFile(fixturePath+"20261019_0.txt", []byte(strings.Join(fixture, "\r\n")+"\r\n"), 0644)
+	})
+	if fixtureErr != nil {
+		t.Fatal(fixtureErr)
+	}
+	return fixturePath
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	if fixturePath != "" {
+		os.RemoveAll(fixturePath)
+	}
+	os.Exit(code)
+}
+
+func get(t *testing.T, h http.Handler, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(logPath(t))
+
+	var spec struct {
+		Paths map[string]struct {
+			Get struct {
+				Responses map[string]struct {
+					Content map[string]struct {
+						Schema map[string]interface{} `json:"schema"`
+					} `json:"content"`
+				} `json:"responses"`
+			} `json:"get"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	err := json.Unmarshal(openAPI, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"cameras", "folders", "ai", "profile"} {
+		path := "/api/" + Version + "/" + name
+		w := get(t, h, http.MethodGet, path)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%v: got %v %q, want 200 JSON", path, w.Code, w.Header().Get("Content-Type"))
+		}
+		body := w.Body.Bytes()
+
+		// The unversioned path serves the current version.
+		if unversioned := get(t, h, http.MethodGet, "/api/"+name); !bytes.Equal(unversioned.Body.Bytes(), body) {
+			t.Errorf("/api/%v: got %s, want %s", name, unversioned.Body, body)
+		}
+
+		var v interface{}
+		err := json.Unmarshal(body, &v)
+		if err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+		operation, ok := spec.Paths[path]
+		if !ok {
+			t.Errorf("%v is not in openapi.json", path)
+			continue
+		}
+		schema := operation.Get.Responses["200"].Content["application/json"].Schema
+		for _, problem := range conform(spec.Components.Schemas, schema, v, "") {
+			t.Errorf("%v: %v", path, problem)
+		}
+
+		golden(t, filepath.Join("testdata", name+".json"), body)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	h := NewHandler(logPath(t))
+	w := get(t, h, http.MethodPost, "/api/v1/cameras")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST: got %v, Allow %q, want 405", w.Code, w.Header().Get("Allow"))
+	}
+	var e apiError
+	err := json.Unmarshal(w.Body.Bytes(), &e)
+	if err != nil || e.Version != Version || e.Error != "method not allowed" {
+		t.Errorf("POST: got %s, want the error", w.Body)
+	}
+
+	w = get(t, NewHandler(filepath.Join(t.TempDir(), "missing")+string(filepath.Separator)), http.MethodGet, "/api/v1/cameras")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("missing log: got %v, want 503", w.Code)
+	}
+
+	w = get(t, h, http.MethodGet, "/api/openapi.json")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), openAPI) {
+		t.Errorf("openapi.json: got %v, want the document", w.Code)
+	}
+}
+
+func TestConform(t *testing.T) {
+	schemas := map[string]map[string]interface{}{
+		"Folder": {
+			"type":     "object",
+			"required": []interface{}{"name", "since"},
+			"properties": map[string]interface{}{
+				"name":  map[string]interface{}{"type": "string"},
+				"since": map[string]interface{}{"type": "string", "nullable": true},
+			},
+		},
+	}
+	schema := map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/Folder"}}
+	v := []interface{}{
+		map[string]interface{}{"name": "New", "since": nil},
+		map[string]interface{}{"name": 1.0, "used": 2.0},
+	}
+	want := []string{"[1].since is missing", "[1].name is float64, want a string", "[1].used is not documented"}
+	if got := conform(schemas, schema, v, ""); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// golden compares got to the file, or writes it with -update.
+func golden(t *testing.T, file string, got []byte) {
+	t.Helper()
+	var indented bytes.Buffer
+	err := json.Indent(&indented, got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		err := os.WriteFile(file, indented.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(indented.Bytes(), bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))) {
+		t.Errorf("%v: got\n%s\nwant\n%s", file, indented.Bytes(), want)
+	}
+}
+
+// conform returns where v doesn't match the OpenAPI schema: a missing
+// required or undocumented field, or a value of the wrong type.
+func conform(schemas map[string]map[string]interface{}, schema map[string]interface{}, v interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return conform(schemas, schemas[strings.TrimPrefix(ref, "#/components/schemas/")], v, at)
+	}
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{fmt.Sprintf("%v is null", at)}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v is %T, want an object", at, v)}
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := o[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%v.%v is missing", at, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		var names []string
+		for name := range o {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p, ok := properties[name].(map[string]interface{})
+			if !ok {
+				p = additional
+			}
+			if p == nil {
+				problems = append(problems, fmt.Sprintf("%v.%v is not documented", at, name))
+				continue
+			}
+			problems = append(problems, conform(schemas, p, o[name], at+"."+name)...)
+		}
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v is %T, want an array", at, v)}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range a {
+			problems = append(problems, conform(schemas, items, item, fmt.Sprintf("%v[%v]", at, i))...)
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%v is %T, want a string", at, v)}
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok {
+			found := false
+			for _, e := range enum {
+				found = found || e == s
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%v is %q, not one of %v", at, s, enum))
+			}
+		}
+	case "number", "integer":
+		if _, ok := v.(float64); !ok {
+			return []string{fmt.Sprintf("%v is %T, want a number", at, v)}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{fmt.Sprintf("%v is %T, want a boolean", at, v)}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+)
+
+var namespace string = "blueiris"
+
+const keepAlive = 15 * time.Second
+
+// Stream sends the parsed events to Server-Sent Events clients as they are
+// read from the log.
+type Stream struct {
+	mutex   sync.Mutex
+	clients map[*client]bool
+	id      uint64
+
+	connected prometheus.Gauge
+	dropped   prometheus.Counter
+}
+
+type client struct {
+	cameras map[string]bool
+	types   map[string]bool
+	events  chan streamEvent
+}
+
+type streamEvent struct {
+	id    uint64
+	event blueiris.Event
+}
+
+func NewStream() *Stream {
+	return &Stream{
+		clients: make(map[*client]bool),
+		connected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "events_stream_clients",
+			Help:      "Count of clients connected to the event stream",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_stream_dropped_total",
+			Help:      "Count of events not sent to a stream client because it was too slow",
+		}),
+	}
+}
+
+// Handle sends an event to the connected clients, it is meant to be
+// registered with blueiris.AddEventHandler. Log events are only sent to
+// clients that ask for them.
+func (s *Stream) Handle(e blueiris.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.id++
+	for c := range s.clients {
+		if !c.match(e) {
+			continue
+		}
+		select {
+		case c.events <- streamEvent{id: s.id, event: e}:
+		default:
+			s.dropped.Inc()
+		}
+	}
+}
+
+func (c *client) match(e blueiris.Event) bool {
+	if len(c.types) > 0 {
+		if !c.types[e.Type] {
+			return false
+		}
+	} else if e.Type == blueiris.EventLog {
+		return false
+	}
+	return len(c.cameras) == 0 || c.cameras[e.Camera]
+}
+
+// ServeHTTP streams the events. The camera and type query parameters limit
+// the events sent, they can be repeated or comma separated.
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	c := &client{
+		cameras: queryValues(r, "camera"),
+		types:   queryValues(r, "type"),
+		events:  make(chan streamEvent, 100),
+	}
+	s.mutex.Lock()
+	s.clients[c] = true
+	s.mutex.Unlock()
+	s.connected.Inc()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.clients, c)
+		s.mutex.Unlock()
+		s.connected.Dec()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-c.events:
+			data, err := json.Marshal(e.event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+func queryValues(r *http.Request, name string) map[string]bool {
+	values := make(map[string]bool)
+	for _, v := range r.URL.Query()[name] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values[s] = true
+			}
+		}
+	}
+	return values
+}
+
+func (s *Stream) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.connected.Desc()
+	ch <- s.dropped.Desc()
+}
+
+func (s *Stream) Collect(ch chan<- prometheus.Metric) {
+	ch <- s.connected
+	ch <- s.dropped
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+)
+
+type frame struct {
+	id    string
+	event string
+	data  blueiris.Event
+}
+
+// connect opens the stream and waits until the client is registered.
+func connect(t *testing.T, ctx context.Context, url string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	r := bufio.NewReader(res.Body)
+	if line, err := r.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("got %q, %v, want the connected comment", line, err)
+	}
+	return res, r
+}
+
+// next reads the next event, skipping comments.
+func next(t *testing.T, r *bufio.Reader) frame {
+	t.Helper()
+	var f frame
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && f.event != "":
+			return f
+		case strings.HasPrefix(line, "id: "):
+			f.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			f.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &f.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+var at = time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+
+func TestStream(t *testing.T) {
+	s := NewStream()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	all, allEvents := connect(t, context.Background(), server.URL)
+	filtered, filteredEvents := connect(t, context.Background(), server.URL+"?camera=Drive,Gate&type=trigger&type=ai")
+	logs, logEvents := connect(t, context.Background(), server.URL+"?type=log")
+	for _, res := range []*http.Response{all, filtered, logs} {
+		if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Content-Type is %q, want text/event-stream", ct)
+		}
+	}
+	configtest.WaitFor(t, s.connected, 3)
+
+	s.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Porch", Line: "porch"})
+	s.Handle(blueiris.Event{Type: blueiris.EventProfile, Time: at, Profile: "Away", Line: "profile"})
+	s.Handle(blueiris.Event{Type: blueiris.EventAI, Time: at, Camera: "Gate", Object: "person", Confidence: 87, Line: "ai"})
+	s.Handle(blueiris.Event{Type: blueiris.EventLog, Time: at, Level: "info", Source: "Gate", Message: "AI: person:87%", Line: "ai"})
+
+	// Log events are only sent when asked for.
+	for _, want := range []string{"1 trigger Porch", "2 profile ", "3 ai Gate"} {
+		if f := next(t, allEvents); f.id+" "+f.event+" "+f.data.Camera != want {
+			t.Errorf("got %+v, want %v", f, want)
+		}
+	}
+	f := next(t, filteredEvents)
+	if f.id != "3" || f.event != blueiris.EventAI || f.data.Object != "person" || f.data.Confidence != 87 || !f.data.Time.Equal(at) {
+		t.Errorf("got %+v, want the AI event of Gate", f)
+	}
+	f = next(t, logEvents)
+	if f.id != "4" || f.event != blueiris.EventLog || f.data.Message != "AI: person:87%" {
+		t.Errorf("got %+v, want the log line", f)
+	}
+}
+
+func TestStreamDisconnect(t *testing.T) {
+	s := NewStream()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	connect(t, ctx, server.URL)
+	configtest.WaitFor(t, s.connected, 1)
+
+	// The client is removed once it goes away, events aren't queued for it.
+	cancel()
+	configtest.WaitFor(t, s.connected, 0)
+	s.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Drive"})
+	s.mutex.Lock()
+	clients := len(s.clients)
+	s.mutex.Unlock()
+	if clients != 0 {
+		t.Errorf("%v clients left after the disconnect", clients)
+	}
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+)
+
+type encoder interface {
+	header() []byte
+	encode(e blueiris.Event) ([]byte, error)
+}
+
+// ndjson writes every event as a JSON object on its own line, with the same
+// fields as the event stream.
+type ndjson struct{}
+
+func (ndjson) header() []byte {
+	return nil
+}
+
+func (ndjson) encode(e blueiris.Event) ([]byte, error) {
+	b, err := json.Marshal(e)
+	return append(b, '\n'), err
+}
+
+var csvColumns = []string{
+	"time", "type", "camera", "ai_provider", "model", "object", "result", "state", "detail", "confidence",
+	"duration_ms", "count", "profile", "folder", "disk_free_bytes", "folder_used_percent", "hours_used_percent",
+	"user", "ip", "replay", "line",
+}
+
+// csvEncoder writes every event as a row with the same columns, the fields
+// that don't apply to the event type are empty.
+type csvEncoder struct{}
+
+func (csvEncoder) header() []byte {
+	return csvRow(csvColumns)
+}
+
+func (csvEncoder) encode(e blueiris.Event) ([]byte, error) {
+	return csvRow([]string{
+		e.Time.Format(time.RFC3339Nano),
+		e.Type,
+		e.Camera,
+		e.Provider,
+		e.Model,
+		e.Object,
+		e.Result,
+		e.State,
+		e.Detail,
+		formatFloat(e.Confidence),
+		formatFloat(e.Duration),
+		formatFloat(e.Count),
+		e.Profile,
+		e.Folder,
+		formatFloat(e.DiskFree),
+		formatFloat(e.FolderUsed),
+		formatFloat(e.HoursUsed),
+		e.User,
+		e.IP,
+		strconv.FormatBool(e.Replay),
+		e.Line,
+	}), nil
+}
+
+func csvRow(fields []string) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(fields)
+	w.Flush()
+	return b.Bytes()
+}
+
+func formatFloat(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,15 @@
+//go:build LINUX
+// +build LINUX
+
+package archive
+
+import (
+	"os"
+	"time"
+)
+
+// created returns when the file was created. Linux doesn't report it through
+// os.FileInfo, the modification time is the closest.
+func created(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
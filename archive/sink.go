@@ -0,0 +1,325 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+const rotatedTime = "20060102T150405"
+
+// Sink writes every event to a file, rotating it by size and age and
+// keeping the last max_files rotated files.
+type Sink struct {
+	path          string
+	encoder       encoder
+	maxSize       int64
+	maxAge        time.Duration
+	maxFiles      int
+	compress      bool
+	includeReplay bool
+	events        chan blueiris.Event
+
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	opened time.Time
+
+	// rotatedStamp and rotatedSeq are the name of the last rotated file, the
+	// sequence keeps counting up in the same second even when the older files
+	// were pruned.
+	rotatedStamp string
+	rotatedSeq   int
+
+	written   prometheus.Counter
+	failures  prometheus.Counter
+	rotations prometheus.Counter
+	dropped   prometheus.Counter
+}
+
+func NewSink(c config.Archive) *Sink {
+	var enc encoder = ndjson{}
+	if c.Format == "csv" {
+		enc = csvEncoder{}
+	}
+	return &Sink{
+		path:          c.Path,
+		encoder:       enc,
+		maxSize:       int64(c.MaxSizeMB) * 1024 * 1024,
+		maxAge:        c.MaxAge,
+		maxFiles:      c.MaxFiles,
+		compress:      c.Compress,
+		includeReplay: c.IncludeReplay,
+		events:        make(chan blueiris.Event, 1000),
+		written: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "archive_events_total",
+			Help:      "Count of events written to the archive",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "archive_write_failures_total",
+			Help:      "Count of events that could not be written to the archive",
+		}),
+		rotations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "archive_rotations_total",
+			Help:      "Count of archive file rotations",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "archive_dropped_events_total",
+			Help:      "Count of events dropped because the queue was full",
+		}),
+	}
+}
+
+// Handle queues an event for writing, it is meant to be registered with
+// blueiris.AddEventHandler.
+func (s *Sink) Handle(e blueiris.Event) {
+	if e.Type == blueiris.EventLog || (e.Replay && !s.includeReplay) {
+		return
+	}
+	select {
+	case s.events <- e:
+	default:
+		s.dropped.Inc()
+	}
+}
+
+func (s *Sink) Run() {
+	ticker := time.NewTicker(time.Second)
+	for {
+		select {
+		case e := <-s.events:
+			err := s.write(e)
+			if err != nil {
+				s.failures.Inc()
+				common.BIlogger(fmt.Sprintf("Archive - Error writing %v. Error: %v", s.path, err), "console")
+			} else {
+				s.written.Inc()
+			}
+		case <-ticker.C:
+			if s.file == nil {
+				continue
+			}
+			err := s.writer.Flush()
+			if err != nil {
+				common.BIlogger(fmt.Sprintf("Archive - Error writing %v. Error: %v", s.path, err), "console")
+			}
+			if s.maxAge > 0 && time.Since(s.opened) >= s.maxAge {
+				s.rotate()
+			}
+		}
+	}
+}
+
+func (s *Sink) write(e blueiris.Event) error {
+	if s.file != nil && (s.size >= s.maxSize || (s.maxAge > 0 && time.Since(s.opened) >= s.maxAge)) {
+		s.rotate()
+	}
+	if s.file == nil {
+		err := s.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := s.encoder.encode(e)
+	if err != nil {
+		return err
+	}
+	n, err := s.writer.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+// open opens the archive file for appending. A new file starts with the
+// header of the format.
+func (s *Sink) open() error {
+	err := os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.writer = bufio.NewWriter(f)
+	s.size = info.Size()
+	s.opened = time.Now()
+	if s.size > 0 {
+		// Appending after a restart, the file's age counts from when it was
+		// created.
+		s.opened = created(info)
+	}
+	if s.size == 0 {
+		n, err := s.writer.Write(s.encoder.header())
+		s.size += int64(n)
+		return err
+	}
+	return nil
+}
+
+// rotate renames the current file with the time it was rotated, compresses
+// it if enabled and removes the oldest rotated files. A file rotated in the
+// same second as the previous one gets a sequence number after the time.
+func (s *Sink) rotate() {
+	err := s.writer.Flush()
+	if err == nil {
+		err = s.file.Close()
+	} else {
+		s.file.Close()
+	}
+	s.file = nil
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("Archive - Error closing %v. Error: %v", s.path, err), "console")
+	}
+
+	ext := filepath.Ext(s.path)
+	stamp := time.Now().Format(rotatedTime)
+	name := func(seq int) string {
+		if seq == 0 {
+			return strings.TrimSuffix(s.path, ext) + "-" + stamp + ext
+		}
+		return strings.TrimSuffix(s.path, ext) + "-" + stamp + "-" + strconv.Itoa(seq) + ext
+	}
+	seq := 0
+	if stamp == s.rotatedStamp {
+		seq = s.rotatedSeq + 1
+	}
+	for exists(name(seq)) || exists(name(seq)+".gz") {
+		seq++
+	}
+	s.rotatedStamp, s.rotatedSeq = stamp, seq
+	rotated := name(seq)
+	err = os.Rename(s.path, rotated)
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("Archive - Error rotating %v. Error: %v", s.path, err), "console")
+		return
+	}
+	s.rotations.Inc()
+
+	if s.compress {
+		err = compress(rotated)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Archive - Error compressing %v. Error: %v", rotated, err), "console")
+		}
+	}
+	s.prune()
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// prune removes the oldest rotated files over max_files. The rotation time
+// and sequence number in the names sort them by age.
+func (s *Sink) prune() {
+	ext := filepath.Ext(s.path)
+	prefix := strings.TrimSuffix(s.path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext + "*")
+	if err != nil {
+		return
+	}
+	type file struct {
+		path string
+		time time.Time
+		seq  int
+	}
+	var rotated []file
+	for _, m := range matches {
+		name := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(m, prefix), ".gz"), ext)
+		stamp, seq, found := strings.Cut(name, "-")
+		t, err := time.Parse(rotatedTime, stamp)
+		if err != nil {
+			continue
+		}
+		n := 0
+		if found {
+			n, err = strconv.Atoi(seq)
+			if err != nil {
+				continue
+			}
+		}
+		rotated = append(rotated, file{m, t, n})
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		if !rotated[i].time.Equal(rotated[j].time) {
+			return rotated[i].time.Before(rotated[j].time)
+		}
+		return rotated[i].seq < rotated[j].seq
+	})
+	for len(rotated) > s.maxFiles {
+		err = os.Remove(rotated[0].path)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Archive - Error removing %v. Error: %v", rotated[0].path, err), "console")
+		}
+		rotated = rotated[1:]
+	}
+}
+
+func (s *Sink) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.written.Desc()
+	ch <- s.failures.Desc()
+	ch <- s.rotations.Desc()
+	ch <- s.dropped.Desc()
+}
+
+func (s *Sink) Collect(ch chan<- prometheus.Metric) {
+	ch <- s.written
+	ch <- s.failures
+	ch <- s.rotations
+	ch <- s.dropped
+}
@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func rotatedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "events-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range matches {
+		matches[i] = filepath.Base(matches[i])
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func TestRotateSameSecond(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		s := NewSink(config.Archive{Path: filepath.Join(dir, "events.ndjson"), Format: "ndjson", MaxFiles: 3, Compress: compress})
+		s.maxSize = 1
+
+		// Every event rotates the file written before it, all within the
+		// same second at most twice.
+		for i := 0; i < 6; i++ {
+			err := s.write(blueiris.Event{Type: blueiris.EventTrigger, Camera: "Drive", Count: float64(i)})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.writer.Flush()
+
+		got := rotatedFiles(t, dir)
+		if len(got) != 3 {
+			t.Fatalf("compress %v: rotated files %v, want the newest 3", compress, got)
+		}
+		// The newest 3 hold the events 2, 3 and 4, in order.
+		var newest []file
+		for _, name := range got {
+			newest = append(newest, parse(t, dir, name))
+		}
+		sort.Slice(newest, func(i, j int) bool { return newest[i].count < newest[j].count })
+		for i, f := range newest {
+			if f.count != float64(i+2) {
+				t.Errorf("compress %v: rotated files %v, want the events 2 to 4", compress, got)
+				break
+			}
+		}
+	}
+}
+
+type file struct {
+	name  string
+	count float64
+}
+
+// parse returns the count of the one trigger in a rotated file.
+func parse(t *testing.T, dir string, name string) file {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if filepath.Ext(name) == ".gz" {
+		r, err = gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var e blueiris.Event
+	err = json.NewDecoder(r).Decode(&e)
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	return file{name, e.Count}
+}
+
+func TestReopenKeepsAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	err := os.WriteFile(path, []byte("{}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(path, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSink(config.Archive{Path: path, Format: "ndjson", MaxSizeMB: 100, MaxAge: time.Hour, MaxFiles: 3})
+	err = s.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(s.opened) < time.Hour {
+		t.Errorf("reopened file counts its age from %v, want the file's time", s.opened)
+	}
+
+	// The next event goes to a new file, the old one is rotated.
+	err = s.write(blueiris.Event{Type: blueiris.EventTrigger, Camera: "Drive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rotatedFiles(t, dir); len(got) != 1 {
+		t.Errorf("rotated files %v, want the old file", got)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !LINUX
+// +build !LINUX
+
+package archive
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// created returns when the file was created.
+func created(info os.FileInfo) time.Time {
+	if d, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, d.CreationTime.Nanoseconds())
+	}
+	return info.ModTime()
+}
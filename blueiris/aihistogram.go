@@ -0,0 +1,101 @@
+package blueiris
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+var aiDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type aiHistogram struct {
+	count     uint64
+	sum       float64
+	buckets   map[float64]uint64
+	exemplars map[float64]prometheus.Exemplar
+}
+
+// aiDurations holds a histogram of the AI durations for every
+// camera|type|provider|model, in the label order of ai_duration_seconds.
+var aiDurations map[string]*aiHistogram = make(map[string]*aiHistogram)
+
+// maxLines is how many AI lines are kept to look up the line of an
+// exemplar by its hash.
+const maxLines = 10000
+
+var (
+	lines     map[string]string = make(map[string]string)
+	lineOrder []string
+)
+
+// observeAIDuration adds an AI duration to the histogram, with the line as
+// the exemplar of its bucket.
+func observeAIDuration(key string, seconds float64, camera string, line string) {
+	h, ok := aiDurations[key]
+	if !ok {
+		h = &aiHistogram{buckets: make(map[float64]uint64), exemplars: make(map[float64]prometheus.Exemplar)}
+		for _, b := range aiDurationBuckets {
+			h.buckets[b] = 0
+		}
+		aiDurations[key] = h
+	}
+	h.count++
+	h.sum += seconds
+	bucket := math.Inf(1)
+	for i := len(aiDurationBuckets) - 1; i >= 0; i-- {
+		if seconds <= aiDurationBuckets[i] {
+			h.buckets[aiDurationBuckets[i]]++
+			bucket = aiDurationBuckets[i]
+		}
+	}
+
+	hash := lineHash(line)
+	h.exemplars[bucket] = prometheus.Exemplar{
+		Value:     seconds,
+		Labels:    prometheus.Labels{"camera": camera, "line_hash": hash},
+		Timestamp: logTime(line),
+	}
+	if _, ok := lines[hash]; !ok {
+		lines[hash] = line
+		lineOrder = append(lineOrder, hash)
+		if len(lineOrder) > maxLines {
+			delete(lines, lineOrder[0])
+			lineOrder = lineOrder[1:]
+		}
+	}
+}
+
+func lineHash(line string) string {
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// LineByHash returns the AI log line with the line_hash of an exemplar.
+func LineByHash(hash string) (string, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	line, ok := lines[hash]
+	return line, ok
+}
+
+func collectAIDurations(ch chan<- prometheus.Metric, sm common.MetricInfo) {
+	for k, h := range aiDurations {
+		labels := strings.Split(k, "|")
+		m := prometheus.MustNewConstHistogram(sm.Desc, h.count, h.sum, h.buckets, labels...)
+		if len(h.exemplars) > 0 {
+			exemplars := make([]prometheus.Exemplar, 0, len(h.exemplars))
+			for _, e := range h.exemplars {
+				exemplars = append(exemplars, e)
+			}
+			if withExemplars, err := prometheus.NewMetricWithExemplars(m, exemplars...); err == nil {
+				m = withExemplars
+			}
+		}
+		ch <- m
+	}
+}
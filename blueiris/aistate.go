@@ -0,0 +1,89 @@
+package blueiris
+
+import (
+	"time"
+)
+
+const (
+	AIRunning  = "running"
+	AIStarting = "starting"
+	AIFailing  = "failing"
+	AIStopped  = "stopped"
+)
+
+var AIStates = []string{AIRunning, AIStarting, AIFailing, AIStopped}
+
+const (
+	aiEventStarting      = "starting"
+	aiEventStarted       = "started"
+	aiEventRestarted     = "restarted"
+	aiEventDetection     = "detection"
+	aiEventTimeout       = "timeout"
+	aiEventServerError   = "server_error"
+	aiEventNotResponding = "not_responding"
+	aiEventError         = "error"
+	aiEventStopped       = "stopped"
+)
+
+// aiService is the availability of one AI provider as seen in the log. Every
+// state but running counts as downtime.
+type aiService struct {
+	state    string
+	since    time.Time
+	downtime float64
+	events   map[string]float64
+}
+
+var aiServices map[string]*aiService = make(map[string]*aiService)
+
+func aiEvent(provider string, event string, t time.Time, line string) {
+	s, ok := aiServices[provider]
+	if !ok {
+		s = &aiService{events: make(map[string]float64)}
+		aiServices[provider] = s
+	}
+	s.events[event]++
+	state := s.state
+	s.transition(event, t)
+	if event != aiEventDetection || s.state != state {
+		emit(Event{Type: EventAIStatus, Time: t, Provider: provider, Result: event, State: s.state, Line: line})
+	}
+}
+
+// aiStatusLine counts an AI status line in its legacy counter and drives the
+// provider's state machine with it.
+func aiStatusLine(counts map[string]float64, provider string, event string, line string) {
+	counts[provider]++
+	aiEvent(provider, event, logTime(line), line)
+}
+
+func (s *aiService) transition(event string, t time.Time) {
+	next := s.state
+	switch event {
+	case aiEventStarting:
+		next = AIStarting
+	case aiEventStarted, aiEventRestarted, aiEventDetection:
+		next = AIRunning
+	case aiEventTimeout, aiEventServerError, aiEventNotResponding, aiEventError:
+		next = AIFailing
+	case aiEventStopped:
+		next = AIStopped
+	}
+	if next == s.state {
+		return
+	}
+
+	if s.state != "" && s.state != AIRunning && t.After(s.since) {
+		s.downtime += t.Sub(s.since).Seconds()
+	}
+	s.state = next
+	s.since = t
+}
+
+// downtimeAt returns the downtime including the current outage up to now.
+func (s *aiService) downtimeAt(now time.Time) float64 {
+	if s.state != "" && s.state != AIRunning && now.After(s.since) {
+		return s.downtime + now.Sub(s.since).Seconds()
+	}
+	return s.downtime
+}
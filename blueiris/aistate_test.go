@@ -0,0 +1,167 @@
+package blueiris
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAIServiceTransition(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	type step struct {
+		event string
+		at    int
+	}
+	tests := []struct {
+		name     string
+		steps    []step
+		state    string
+		since    int
+		downtime float64
+		now      int
+		current  float64
+	}{
+		{
+			name: "restart cycle",
+			steps: []step{
+				{aiEventStarting, 0},
+				{aiEventStarted, 10},
+				{aiEventTimeout, 100},
+				{aiEventRestarted, 130},
+				{aiEventStopped, 200},
+			},
+			state:    AIStopped,
+			since:    200,
+			downtime: 40,
+			now:      260,
+			current:  100,
+		},
+		{
+			name: "repeated identical events",
+			steps: []step{
+				{aiEventTimeout, 0},
+				{aiEventTimeout, 10},
+				{aiEventServerError, 20},
+				{aiEventStarted, 50},
+				{aiEventDetection, 60},
+				{aiEventDetection, 70},
+			},
+			state:    AIRunning,
+			since:    50,
+			downtime: 50,
+			now:      100,
+			current:  50,
+		},
+		{
+			name: "ongoing outage",
+			steps: []step{
+				{aiEventStarted, 0},
+				{aiEventError, 100},
+				{aiEventNotResponding, 150},
+			},
+			state:    AIFailing,
+			since:    100,
+			downtime: 0,
+			now:      400,
+			current:  300,
+		},
+		{
+			name: "recovered outage before another",
+			steps: []step{
+				{aiEventStarted, 0},
+				{aiEventTimeout, 10},
+				{aiEventDetection, 25},
+				{aiEventStopped, 40},
+			},
+			state:    AIStopped,
+			since:    40,
+			downtime: 15,
+			now:      50,
+			current:  25,
+		},
+		{
+			name: "time going backwards",
+			steps: []step{
+				{aiEventStarting, 100},
+				{aiEventStarted, 90},
+			},
+			state:    AIRunning,
+			since:    90,
+			downtime: 0,
+			now:      120,
+			current:  0,
+		},
+		{
+			name: "now before the outage started",
+			steps: []step{
+				{aiEventTimeout, 100},
+			},
+			state:    AIFailing,
+			since:    100,
+			downtime: 0,
+			now:      50,
+			current:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &aiService{events: make(map[string]float64)}
+			for _, st := range tt.steps {
+				s.transition(st.event, at(st.at))
+			}
+			if s.state != tt.state {
+				t.Errorf("state is %q, want %q", s.state, tt.state)
+			}
+			if !s.since.Equal(at(tt.since)) {
+				t.Errorf("since is %v, want %v", s.since, at(tt.since))
+			}
+			if s.downtime != tt.downtime {
+				t.Errorf("downtime is %v, want %v", s.downtime, tt.downtime)
+			}
+			if d := s.downtimeAt(at(tt.now)); d != tt.current {
+				t.Errorf("downtime at %vs is %v, want %v", tt.now, d, tt.current)
+			}
+		})
+	}
+}
+
+func TestAIEventRepeatedDetections(t *testing.T) {
+	savedHandlers, savedServices := eventHandlers, aiServices
+	defer func() {
+		eventHandlers, aiServices = savedHandlers, savedServices
+		pendingEvents = nil
+	}()
+	eventHandlers = []func(Event){func(Event) {}}
+	aiServices = make(map[string]*aiService)
+	pendingEvents = nil
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	for i, event := range []string{aiEventStarted, aiEventDetection, aiEventDetection, aiEventTimeout, aiEventDetection, aiEventDetection} {
+		aiEvent("DeepStack", event, start.Add(time.Duration(i)*time.Second), "")
+	}
+
+	// Detections only show up as events when they bring the provider back.
+	var got []string
+	for _, e := range pendingEvents {
+		got = append(got, e.Result+":"+e.State)
+	}
+	want := []string{"started:running", "timeout:failing", "detection:running"}
+	if len(got) != len(want) {
+		t.Fatalf("events %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("events %v, want %v", got, want)
+		}
+	}
+
+	s := aiServices["DeepStack"]
+	if s.events[aiEventDetection] != 4 {
+		t.Errorf("%v detections counted, want 4", s.events[aiEventDetection])
+	}
+	if s.downtime != 1 {
+		t.Errorf("downtime is %v, want 1", s.downtime)
+	}
+}
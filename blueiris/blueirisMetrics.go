@@ -23,32 +23,37 @@ type aidata struct {
 	alertcount float64
 	detail     string
 	latest     string
+	provider   string
+	model      string
 }
 
 var lastLogLine string = ""
 var lastLogFile string = ""
 
+// serverStartRegex matches the lines Blue Iris writes when it starts, with its
+// version.
+var serverStartRegex = regexp.MustCompile(`\s(App|Blue Iris)\s+(Blue Iris\s+v?\d+\.\d+\.\d+|Start(ed|ing)?\b)`)
+
 var (
-	timeoutcount        float64                           = 0
-	servererrorcount    float64                           = 0
-	notrespondingcount  float64                           = 0
-	errorMetricsTotal   float64                           = 0
-	warningMetricsTotal float64                           = 0
-	parseErrorsTotal    float64                           = 0
-	restartCount        float64                           = 0
-	aiErrorCount        float64                           = 0
-	aiRestartingCount   float64                           = 0
-	aiRestartedCount    float64                           = 0
-	triggerCount        map[string]float64                = make(map[string]float64)
-	pushCount           map[string]float64                = make(map[string]float64)
-	errorMetrics        map[string]float64                = make(map[string]float64)
-	warningMetrics      map[string]float64                = make(map[string]float64)
-	parseErrors         map[string]float64                = make(map[string]float64)
-	profileCount        map[string]float64                = make(map[string]float64)
-	aiMetrics           map[string]aidata                 = make(map[string]aidata)
-	diskStats           map[string]map[string]float64     = make(map[string]map[string]float64)
-	camerastatus        map[string]map[string]interface{} = make(map[string]map[string]interface{})
-	latestai            map[string]string                 = make(map[string]string)
+	timeoutcount        map[string]float64            = make(map[string]float64)
+	servererrorcount    map[string]float64            = make(map[string]float64)
+	notrespondingcount  map[string]float64            = make(map[string]float64)
+	errorMetricsTotal   float64                       = 0
+	warningMetricsTotal float64                       = 0
+	parseErrorsTotal    float64                       = 0
+	restartCount        map[string]float64            = make(map[string]float64)
+	aiErrorCount        map[string]float64            = make(map[string]float64)
+	aiRestartingCount   map[string]float64            = make(map[string]float64)
+	aiRestartedCount    map[string]float64            = make(map[string]float64)
+	triggerCount        map[string]float64            = make(map[string]float64)
+	pushCount           map[string]float64            = make(map[string]float64)
+	errorMetrics        map[string]float64            = make(map[string]float64)
+	warningMetrics      map[string]float64            = make(map[string]float64)
+	parseErrors         map[string]float64            = make(map[string]float64)
+	profileCount        map[string]float64            = make(map[string]float64)
+	aiMetrics           map[string]aidata             = make(map[string]aidata)
+	diskStats           map[string]map[string]float64 = make(map[string]map[string]float64)
+	latestai            map[string]string             = make(map[string]string)
 )
 
 var mutex = sync.RWMutex{}
@@ -58,135 +63,92 @@ func BlueIris(ch chan<- prometheus.Metric, m common.MetricInfo, SecMet []common.
 	scrapeTime := time.Now()
 	mutex.Lock()
 
-	startScanning := false
-
-	dir := logpath
-	files, err := ioutil.ReadDir(dir)
-	if err != nil {
-		common.BIlogger(fmt.Sprintf("BlueIris - Error reading blue_iris log directory. Error: %v", err), "error")
-		ch <- prometheus.MustNewConstMetric(m.Errors.WithLabelValues("BlueIris").Desc(), prometheus.CounterValue, 1, "BlueIris")
-		return
-	}
-	var newestFile string
-	var newestTime int64 = 0
-	for _, f := range files {
-		fi, err := os.Stat(dir + f.Name())
-		if err != nil {
-			common.BIlogger(err.Error(), "error")
-		}
-		currTime := fi.ModTime().Unix()
-		if currTime > newestTime {
-			newestTime = currTime
-			newestFile = f.Name()
-		}
-	}
-
-	file, err := os.Open(dir + newestFile)
+	err := readLog(logpath)
 	if err != nil {
-		common.BIlogger(fmt.Sprintf("BlueIris - Error opening latest log file. Error: %v", err), "error")
+		common.BIlogger(fmt.Sprintf("BlueIris - %v", err), "error")
 		ch <- prometheus.MustNewConstMetric(m.Errors.WithLabelValues("BlueIris").Desc(), prometheus.CounterValue, 1, "BlueIris")
+		mutex.Unlock()
+		flushEvents()
 		return
 	}
-	defer file.Close()
-
-	if lastLogFile != "" && lastLogFile != newestFile {
-		startScanning = true
-	}
-	lastLogFile = newestFile
-
-	scanner := bufio.NewScanner(file)
-	scanner.Scan()
-
-	for scanner.Scan() {
-		if lastLogLine == scanner.Text() || lastLogLine == "" {
-			startScanning = true
-			if lastLogLine == "" {
-				lastLogLine = scanner.Text()
-			}
-			continue
-		}
-
-		if startScanning {
-			lastLogLine = scanner.Text()
-			match, r, matchType := findObject(scanner.Text())
-			if (matchType == "alert") || (matchType == "canceled") {
-				cameraMatch := r.SubexpIndex("camera")
-				durationMatch := r.SubexpIndex("duration")
-				objectMatch := r.SubexpIndex("object")
-				detailMatch := r.SubexpIndex("detail")
-
-				camera := match[cameraMatch]
-				duration, err := strconv.ParseFloat(match[durationMatch], 64)
-				if err != nil {
-					common.BIlogger(fmt.Sprintf("BlueIris - Error parsing duration float. Err: %v", err), "error")
-					ch <- prometheus.MustNewConstMetric(m.Errors.WithLabelValues(err.Error()).Desc(), prometheus.CounterValue, 1, "BlueIris")
-					continue
-				}
-
-				alertcount := aiMetrics[camera+matchType].alertcount
-				alertcount++
-
-				makeMap(camera, camerastatus)
-				camerastatus[camera]["status"] = 0.0
-				camerastatus[camera]["detail"] = "object"
-				aiMetrics[camera+matchType] = aidata{
-					camera:     camera,
-					duration:   duration,
-					object:     match[objectMatch],
-					alertcount: alertcount,
-					detail:     match[detailMatch],
-					latest:     scanner.Text(),
-				}
-			}
-		}
-	}
 
 	for k, a := range aiMetrics {
 		if strings.Contains(k, "alert") {
-			ch <- prometheus.MustNewConstMetric(m.Desc, m.Type, a.duration, a.camera, "alert", a.object, a.detail)
+			ch <- prometheus.MustNewConstMetric(m.Desc, m.Type, a.duration, a.camera, "alert", a.object, a.detail, a.provider, a.model)
 		} else if strings.Contains(k, "canceled") {
-			ch <- prometheus.MustNewConstMetric(m.Desc, m.Type, a.duration, a.camera, "canceled", a.object, a.detail)
+			ch <- prometheus.MustNewConstMetric(m.Desc, m.Type, a.duration, a.camera, "canceled", a.object, a.detail, a.provider, a.model)
 		}
 	}
 
+	states := cameraStates()
+
 	for _, sm := range SecMet {
 		switch sm.Name {
 		case "ai_count":
 			for k, a := range aiMetrics {
 				if strings.Contains(k, "alert") {
-					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.alertcount, a.camera, "alert")
+					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.alertcount, a.camera, "alert", a.provider, a.model)
 				} else if strings.Contains(k, "canceled") {
-					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.alertcount, a.camera, "canceled")
+					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.alertcount, a.camera, "canceled", a.provider, a.model)
 				}
 			}
 		case "ai_duration_distinct":
 			for k, a := range aiMetrics {
 				if strings.Contains(k, "alert") {
-					if a.latest != latestai[a.camera+"alert"] {
-						ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.duration, a.camera, "alert", a.object, a.detail)
-						latestai[a.camera+"alert"] = a.latest
+					if a.latest != latestai[k] {
+						ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.duration, a.camera, "alert", a.object, a.detail, a.provider, a.model)
+						latestai[k] = a.latest
 					}
 				} else if strings.Contains(k, "canceled") {
-					if a.latest != latestai[a.camera+"canceled"] {
-						ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.duration, a.camera, "canceled", a.object, a.detail)
-						latestai[a.camera+"canceled"] = a.latest
+					if a.latest != latestai[k] {
+						ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.duration, a.camera, "canceled", a.object, a.detail, a.provider, a.model)
+						latestai[k] = a.latest
 					}
 				}
 			}
 		case "ai_error":
-			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, aiErrorCount)
+			collectProviderCounts(ch, sm, aiErrorCount)
 		case "ai_starting":
-			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, aiRestartingCount)
+			collectProviderCounts(ch, sm, aiRestartingCount)
 		case "ai_started":
-			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, aiRestartedCount)
+			collectProviderCounts(ch, sm, aiRestartedCount)
 		case "ai_restarted":
-			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, restartCount)
+			collectProviderCounts(ch, sm, restartCount)
 		case "ai_timeout":
-			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, timeoutcount)
+			collectProviderCounts(ch, sm, timeoutcount)
 		case "ai_servererror":
-			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, servererrorcount)
+			collectProviderCounts(ch, sm, servererrorcount)
 		case "ai_notresponding":
-			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, notrespondingcount)
+			collectProviderCounts(ch, sm, notrespondingcount)
+		case "ai_state":
+			for provider, a := range aiServices {
+				if a.state == "" {
+					continue
+				}
+				for _, s := range AIStates {
+					v := 0.0
+					if a.state == s {
+						v = 1.0
+					}
+					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, provider, s)
+				}
+			}
+		case "ai_downtime_seconds_total":
+			for provider, a := range aiServices {
+				ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, a.downtimeAt(time.Now()), provider)
+			}
+		case "ai_events_total":
+			for provider, a := range aiServices {
+				for event, v := range a.events {
+					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, provider, event)
+				}
+			}
+		case "ai_duration_seconds":
+			collectAIDurations(ch, sm)
+		case "ai_module_duration":
+			for module, v := range aiModuleDuration {
+				ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, "codeproject", module)
+			}
 		case "triggers":
 			for c, v := range triggerCount {
 				ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, c)
@@ -247,20 +209,32 @@ func BlueIris(ch chan<- prometheus.Metric, m common.MetricInfo, SecMet []common.
 		case "logwarning_total":
 			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, warningMetricsTotal)
 		case "camera_status":
-			status := 1.0
-			for k, a := range camerastatus {
-
-				switch i := a["status"].(type) {
-				case float64:
-					status = float64(i)
-					detail, ok := a["detail"].(string)
-					if !ok {
-						common.BIlogger(fmt.Sprintf("Invalid type for camera_status detail: \n%v", ok), "error")
+			for k, a := range states {
+				status := 1.0
+				if a.state == CameraUp {
+					status = 0.0
+				}
+				ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, status, k, a.detail)
+			}
+		case "web_logins_total":
+			for k, v := range webLoginCount {
+				details := strings.Split(k, "|")
+				ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, details[0], details[1], details[2])
+			}
+		case "web_bans_total":
+			for ip, v := range webBanCount {
+				ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, ip)
+			}
+		case "web_last_failed_login_timestamp_seconds":
+			ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, webLastFailedLogin)
+		case "camera_state":
+			for k, a := range states {
+				for _, s := range CameraStates {
+					v := 0.0
+					if a.state == s {
+						v = 1.0
 					}
-					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, status, k, detail)
-
-				default:
-					common.BIlogger(fmt.Sprintf("Invalid type for camera_status status: \n%v", i), "error")
+					ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, k, s)
 				}
 			}
 		}
@@ -270,12 +244,131 @@ func BlueIris(ch chan<- prometheus.Metric, m common.MetricInfo, SecMet []common.
 	ch <- prometheus.MustNewConstMetric(m.Timer, prometheus.GaugeValue, time.Since(scrapeTime).Seconds(), "BlueIris")
 
 	mutex.Unlock()
+	flushEvents()
 }
 
-func makeMap(camera string, m map[string]map[string]interface{}) {
-	if _, ok := m[camera]; !ok {
-		m[camera] = make(map[string]interface{})
+// readLog parses the lines of the newest log file added since the last read.
+// The caller must hold the mutex.
+func readLog(logpath string) (err error) {
+	defer func() {
+		if err != nil {
+			lastReadError = err.Error()
+		} else {
+			lastRead = time.Now()
+			lastReadError = ""
+		}
+	}()
+	startScanning := false
+
+	dir := logpath
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading blue_iris log directory: %v", err)
 	}
+	var newestFile string
+	var newestTime int64 = 0
+	for _, f := range files {
+		fi, err := os.Stat(dir + f.Name())
+		if err != nil {
+			common.BIlogger(err.Error(), "error")
+		}
+		currTime := fi.ModTime().Unix()
+		if currTime > newestTime {
+			newestTime = currTime
+			newestFile = f.Name()
+		}
+	}
+
+	file, err := os.Open(dir + newestFile)
+	if err != nil {
+		return fmt.Errorf("error opening latest log file: %v", err)
+	}
+	defer file.Close()
+
+	replaying = lastLogFile == ""
+	if lastLogFile != "" && lastLogFile != newestFile {
+		startScanning = true
+	}
+	lastLogFile = newestFile
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+
+	number := 1
+	for scanner.Scan() {
+		number++
+		if lastLogLine == scanner.Text() || lastLogLine == "" {
+			startScanning = true
+			if lastLogLine == "" {
+				lastLogLine = scanner.Text()
+				lastLogLineNumber = number
+			}
+			continue
+		}
+
+		if startScanning {
+			lastLogLine = scanner.Text()
+			lastLogLineNumber = number
+			match, r, matchType := findObject(scanner.Text())
+			if (matchType == "alert") || (matchType == "canceled") {
+				parseAI(match, r, matchType, scanner.Text())
+			}
+			emitLine(scanner.Text())
+		}
+	}
+	return nil
+}
+
+func parseAI(match []string, r *regexp.Regexp, matchType string, line string) {
+	cameraMatch := r.SubexpIndex("camera")
+	durationMatch := r.SubexpIndex("duration")
+	objectMatch := r.SubexpIndex("object")
+	detailMatch := r.SubexpIndex("detail")
+
+	camera := match[cameraMatch]
+	duration, err := strconv.ParseFloat(match[durationMatch], 64)
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("BlueIris - Error parsing duration float. Err: %v", err), "error")
+		return
+	}
+
+	provider := aiProvider(line)
+	model := aiModel(match[r.SubexpIndex("model")])
+	key := camera + "|" + provider + "|" + model + "|" + matchType
+	alertcount := aiMetrics[key].alertcount
+	alertcount++
+
+	touchCamera(camera, line)
+	aiMetrics[key] = aidata{
+		camera:     camera,
+		duration:   duration,
+		object:     match[objectMatch],
+		alertcount: alertcount,
+		detail:     match[detailMatch],
+		latest:     line,
+		provider:   provider,
+		model:      model,
+	}
+	aiEvent(provider, aiEventDetection, logTime(line), line)
+	observeAIDuration(camera+"|"+matchType+"|"+provider+"|"+model, duration/1000, camera, line)
+	if provider == "codeproject" && model != "default" {
+		aiModuleDuration[model] = duration
+	}
+	confidence, _ := strconv.ParseFloat(match[detailMatch], 64)
+	emit(Event{
+		Type:       EventAI,
+		Time:       logTime(line),
+		Camera:     camera,
+		Provider:   provider,
+		Model:      model,
+		Object:     match[objectMatch],
+		Result:     matchType,
+		Detail:     match[detailMatch],
+		Confidence: confidence,
+		Duration:   duration,
+		Count:      alertcount,
+		Line:       line,
+	})
 }
 
 func convertStrFloat(s string) (f float64, err error) {
@@ -315,41 +408,42 @@ func convertBytes(s string, unit string) (f float64, err error) {
 func findObject(line string) (match []string, r *regexp.Regexp, matchType string) {
 
 	if strings.HasSuffix(line, "AI: timeout") {
-		timeoutcount++
+		aiStatusLine(timeoutcount, aiProvider(line), aiEventTimeout, line)
 
 	} else if strings.Contains(line, "AI has been restarted") {
-		restartCount++
+		aiStatusLine(restartCount, aiProvider(line), aiEventRestarted, line)
 
 	} else if strings.Contains(line, "AI: error") {
-		aiErrorCount++
+		aiStatusLine(aiErrorCount, aiProvider(line), aiEventError, line)
 
 	} else if strings.Contains(line, "AI: is being started") || strings.Contains(line, "AI is being restarted") {
-		aiRestartingCount++
+		aiStatusLine(aiRestartingCount, aiProvider(line), aiEventStarting, line)
 
 	} else if strings.Contains(line, "AI: has been started") || strings.Contains(line, "AI has been started") {
-		aiRestartedCount++
+		aiStatusLine(aiRestartedCount, aiProvider(line), aiEventStarted, line)
 
-	} else if strings.Contains(line, "DeepStack: Server error") {
-		servererrorcount++
+	} else if strings.Contains(line, "DeepStack: Server error") || strings.Contains(line, "CodeProject.AI: Server error") {
+		aiStatusLine(servererrorcount, aiProvider(line), aiEventServerError, line)
 
 	} else if strings.HasSuffix(line, "AI: not responding") {
-		notrespondingcount++
+		aiStatusLine(notrespondingcount, aiProvider(line), aiEventNotResponding, line)
+
+	} else if strings.Contains(line, "AI: stopped") || strings.Contains(line, "AI has been stopped") || strings.Contains(line, "AI: not running") {
+		aiEvent(aiProvider(line), aiEventStopped, logTime(line), line)
+
+	} else if strings.Contains(line, "CodeProject.AI") && !codeProjectDetectionRegex.MatchString(line) {
+		parseCodeProjectStatus(line)
 
 	} else if strings.Contains(line, "AI:") || strings.Contains(line, "DeepStack:") || strings.Contains(line, "Trigger: Alert canceled") {
 		newLine := strings.Join(strings.Fields(line), " ")
-		r := regexp.MustCompile(`(?P<camera>[^\s\\]*)(\sAI:\s|\sDeepStack:\s|\sTrigger:\s)(\[Objects\]\s|Alert\s|\[.+\]\s|)(?P<object>[aA-zZ]*|cancelled|canceled)(\s|:)(\[|)(?P<detail>[0-9]*|.*)(%|\])(\s)(\[.+\]\s|)(?P<duration>[0-9]*)ms`)
+		r := regexp.MustCompile(`(?P<camera>[^\s\\]*)(\sAI:\s|\sDeepStack:\s|\sCodeProject\.AI:\s|\sTrigger:\s)(?P<model>\[Objects\]\s|Alert\s|\[.+?\]\s|)(?P<object>[aA-zZ]*|cancelled|canceled)(\s|:)(\[|)(?P<detail>[0-9]*|.*)(%|\])(\s)(\[.+\]\s|)(?P<duration>[0-9]*)ms`)
 		match := r.FindStringSubmatch(newLine)
 
-		if strings.Contains(newLine, "CodeProject.AI") {
-			return nil, nil, ""
-		}
-
 		if len(match) == 0 {
-			r2 := regexp.MustCompile(`(?P<camera>[^\s\\]*)(\sAI:\s|\sDeepStack:\s)(\[Objects\]\s|Alert\s|\[.+\]\s|)(?P<object>[aA-zZ]*|cancelled|canceled)(\s|:)(\[|)(?P<detail>[0-9]*|.*)`)
+			r2 := regexp.MustCompile(`(?P<camera>[^\s\\]*)(\sAI:\s|\sDeepStack:\s|\sCodeProject\.AI:\s)(\[Objects\]\s|Alert\s|\[.+\]\s|)(?P<object>[aA-zZ]*|cancelled|canceled)(\s|:)(\[|)(?P<detail>[0-9]*|.*)`)
 			match2 := r2.FindStringSubmatch(newLine)
 			if len(match2) == 0 {
-				parseErrors = appendCounterMap(parseErrors, line)
-				parseErrorsTotal++
+				addParseError(line)
 			}
 			return nil, nil, ""
 		} else {
@@ -364,16 +458,15 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 		r := regexp.MustCompile(`(?P<camera>[^\s\\]*)(\s*(?P<motion>EXTERNAL|MOTION|DIO|Triggered|Re-triggered|Trigger))`)
 		match := r.FindStringSubmatch(line)
 		if len(match) == 0 {
-			parseErrors = appendCounterMap(parseErrors, line)
-			parseErrorsTotal++
+			addParseError(line)
 		} else {
 			if !strings.Contains(line, "Alert canceled") || !strings.Contains(line, "Alert confirmed") {
 				cameraMatch := r.SubexpIndex("camera")
 				camera := match[cameraMatch]
 				triggerCount[camera]++
-				makeMap(camera, camerastatus)
-				camerastatus[camera]["status"] = 0.0
-				camerastatus[camera]["detail"] = "trigger"
+				lastTrigger[camera] = logTime(line)
+				touchCamera(camera, line)
+				emit(Event{Type: EventTrigger, Time: logTime(line), Camera: camera, Detail: match[r.SubexpIndex("motion")], Count: triggerCount[camera], Line: line})
 			}
 		}
 
@@ -381,8 +474,7 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 		r := regexp.MustCompile(`(?P<camera>[^\s\\]*)(\s*Push:\s)(?P<status>.+)(\sto\s)(?P<detail>.+)`)
 		match := r.FindStringSubmatch(line)
 		if len(match) == 0 {
-			parseErrors = appendCounterMap(parseErrors, line)
-			parseErrorsTotal++
+			addParseError(line)
 		} else {
 			cameraMatch := r.SubexpIndex("camera")
 			statusMatch := r.SubexpIndex("status")
@@ -392,14 +484,14 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 			detail := match[detailMatch]
 
 			pushCount[camera+"|"+status+"|"+detail]++
+			emit(Event{Type: EventPush, Time: logTime(line), Camera: camera, Result: status, Detail: detail, Line: line})
 		}
 
 	} else if strings.Contains(line, "Signal:") {
 		r := regexp.MustCompile(`(?P<camera>[^\s\\]*)(\s*Signal:\s)(?P<status>.+)`)
 		match := r.FindStringSubmatch(line)
 		if len(match) == 0 {
-			parseErrors = appendCounterMap(parseErrors, line)
-			parseErrorsTotal++
+			addParseError(line)
 		} else {
 			cameraMatch := r.SubexpIndex("camera")
 			statusMatch := r.SubexpIndex("status")
@@ -407,23 +499,19 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 			camera := match[cameraMatch]
 			status := match[statusMatch]
 
-			makeMap(camera, camerastatus)
-
 			if strings.Contains(status, "restored") {
-				camerastatus[camera]["status"] = 0.0
-			} else if strings.HasPrefix(line, "4") {
-				camerastatus[camera]["status"] = 0.0
+				setCameraState(camera, CameraUp, status, line)
 			} else {
-				camerastatus[camera]["status"] = 1.0
+				setCameraState(camera, CameraNoSignal, status, line)
 			}
-			camerastatus[camera]["detail"] = status
 		}
+	} else if serverStartRegex.MatchString(line) {
+		emit(Event{Type: EventServerStart, Time: logTime(line), Line: line})
 	} else if strings.Contains(line, "Current profile:") {
 		r := regexp.MustCompile(`(App)(\s*Current profile:\s)(?P<profile>.+)`)
 		match := r.FindStringSubmatch(line)
 		if len(match) == 0 {
-			parseErrors = appendCounterMap(parseErrors, line)
-			parseErrorsTotal++
+			addParseError(line)
 		} else {
 			profileMatch := r.SubexpIndex("profile")
 			profile := match[profileMatch]
@@ -431,6 +519,8 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 				profileCount[f] = 0
 			}
 			profileCount[profile] = 1
+			profileSince = logTime(line)
+			emit(Event{Type: EventProfile, Time: logTime(line), Profile: profile, Line: line})
 		}
 	} else if strings.Contains(line, "Delete: ") && strings.HasPrefix(line, "0 ") {
 		// Parse out the date
@@ -452,8 +542,7 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 						match2 := r2.FindStringSubmatch(logline)
 						ignore := r2.SubexpIndex("ignore")
 						if strings.Compare(match2[ignore], "") == 0 {
-							parseErrors = appendCounterMap(parseErrors, line)
-							parseErrorsTotal++
+							addParseError(line)
 						}
 						return nil, nil, ""
 					}
@@ -488,11 +577,7 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 							return nil, nil, ""
 						}
 						sizePercent1 := (sizeused1 / sizelimit1) * 100
-						if _, ok := diskStats[folder1]; !ok {
-							diskStats[folder1] = make(map[string]float64)
-						}
-						diskStats[folder1]["diskfree"] = diskfree1
-						diskStats[folder1]["sizePercent"] = sizePercent1
+						setDiskStats(folder1, line, map[string]float64{"diskfree": diskfree1, "sizePercent": sizePercent1})
 					} else {
 						sizeused1, err := convertBytes(match1[sizeusedMatch1], match1[sizeunitMatch1])
 						if err != nil {
@@ -501,11 +586,7 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 							return nil, nil, ""
 						}
 						sizePercent1 := (sizeused1 / sizelimit1) * 100
-						if _, ok := diskStats[folder1]; !ok {
-							diskStats[folder1] = make(map[string]float64)
-						}
-						diskStats[folder1]["diskfree"] = diskfree1
-						diskStats[folder1]["sizePercent"] = sizePercent1
+						setDiskStats(folder1, line, map[string]float64{"diskfree": diskfree1, "sizePercent": sizePercent1})
 					}
 
 				} else {
@@ -550,14 +631,7 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 							return nil, nil, ""
 						}
 						sizePercent := (sizeused / sizelimit) * 100
-
-						if _, ok := diskStats[folder]; !ok {
-							diskStats[folder] = make(map[string]float64)
-						}
-
-						diskStats[folder]["diskfree"] = diskfree
-						diskStats[folder]["hourPercent"] = hourPercent
-						diskStats[folder]["sizePercent"] = sizePercent
+						setDiskStats(folder, line, map[string]float64{"diskfree": diskfree, "hourPercent": hourPercent, "sizePercent": sizePercent})
 					} else {
 						sizeused, err := convertBytes(match[sizeusedMatch], match[sizeunitMatch])
 						if err != nil {
@@ -565,30 +639,26 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 							return nil, nil, ""
 						}
 						sizePercent := (sizeused / sizelimit) * 100
-
-						if _, ok := diskStats[folder]; !ok {
-							diskStats[folder] = make(map[string]float64)
-						}
-
-						diskStats[folder]["diskfree"] = diskfree
-						diskStats[folder]["hourPercent"] = hourPercent
-						diskStats[folder]["sizePercent"] = sizePercent
+						setDiskStats(folder, line, map[string]float64{"diskfree": diskfree, "hourPercent": hourPercent, "sizePercent": sizePercent})
 					}
 				}
 			}
 		}
 
+	} else if isWebLine(line) {
+		parseWebLine(line)
+
 	} else if strings.HasPrefix(line, "2") {
 		r := regexp.MustCompile(`.*\s\s\s(?P<error>.*)`)
 		match := r.FindStringSubmatch(line)
 		if len(match) == 0 {
-			parseErrors = appendCounterMap(parseErrors, line)
-			parseErrorsTotal++
+			addParseError(line)
 			return nil, nil, ""
 		} else {
 			ErrorMatch := r.SubexpIndex("error")
 			e := match[ErrorMatch]
 			errorMetricsTotal++
+			emit(Event{Type: EventError, Time: logTime(line), Detail: e, Line: line})
 			if val, ok := errorMetrics[e]; ok {
 				val++
 				errorMetrics[e] = val
@@ -601,13 +671,13 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 		r := regexp.MustCompile(`.*\s\s\s(?P<warning>.*)`)
 		match := r.FindStringSubmatch(line)
 		if len(match) == 0 {
-			parseErrors = appendCounterMap(parseErrors, line)
-			parseErrorsTotal++
+			addParseError(line)
 			return nil, nil, ""
 		} else {
 			WarningMatch := r.SubexpIndex("warning")
 			e := match[WarningMatch]
 			warningMetricsTotal++
+			emit(Event{Type: EventWarning, Time: logTime(line), Detail: e, Line: line})
 			if val, ok := warningMetrics[e]; ok {
 				val++
 				warningMetrics[e] = val
@@ -619,16 +689,47 @@ func findObject(line string) (match []string, r *regexp.Regexp, matchType string
 	return nil, nil, ""
 }
 
-func appendCounterMap(m map[string]float64, key string) map[string]float64 {
+func setDiskStats(folder string, line string, stats map[string]float64) {
+	if _, ok := diskStats[folder]; !ok {
+		diskStats[folder] = make(map[string]float64)
+	}
+	for k, v := range stats {
+		diskStats[folder][k] = v
+	}
+	emit(Event{
+		Type:       EventFolder,
+		Time:       logTime(line),
+		Folder:     folder,
+		DiskFree:   diskStats[folder]["diskfree"],
+		FolderUsed: diskStats[folder]["sizePercent"],
+		HoursUsed:  diskStats[folder]["hourPercent"],
+		Line:       line,
+	})
+}
+
+func addParseError(line string) {
+	parseErrors = appendCounterMap(parseErrors, line)
+	parseErrorsTotal++
+	key := counterKey(line)
+	emit(Event{Type: EventParseError, Time: logTime(line), Detail: key, Count: parseErrors[key], Line: line})
+}
+
+// counterKey strips the level and timestamp from a log line.
+func counterKey(key string) string {
 	logr := regexp.MustCompile(`^.+(\.\d\d\d|\s[APM]{2})\s(?P<log>.+)`)
 	logmatch := logr.FindStringSubmatch(key)
-	
+
 	logKey := key
 	if len(logmatch) != 0 {
 		loglineMatch := logr.SubexpIndex("log")
 		logKey = logmatch[loglineMatch]
 	}
-	
+	return logKey
+}
+
+func appendCounterMap(m map[string]float64, key string) map[string]float64 {
+	logKey := counterKey(key)
+
 	if val, ok := m[logKey]; ok {
 		val++
 		m[logKey] = val
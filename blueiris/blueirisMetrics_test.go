@@ -0,0 +1,49 @@
+package blueiris
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerStart(t *testing.T) {
+	saved := eventHandlers
+	defer func() {
+		eventHandlers = saved
+		pendingEvents = nil
+	}()
+	eventHandlers = []func(Event){func(Event) {}}
+
+	tests := []struct {
+		line  string
+		start bool
+	}{
+		{"0 \t10/19/2026 3:00:00.123 PM\tApp           Blue Iris 5.9.9.12 x64 (10/02/2026)", true},
+		{"0 \t10/19/2026 3:00:00.123 PM\tApp           Blue Iris v5.8.6.4", true},
+		{"0 \t10/19/2026 3:00:00.456 PM\tApp           Starting", true},
+		{"0 \t10/19/2026 3:00:01.002 PM\tBlue Iris     Started", true},
+		{"0 \t10/19/2026 3:00:02.000 PM\tApp           Current profile: 1", false},
+		{"0 \t10/19/2026 3:00:02.000 PM\tApp           Web server started on port 81", false},
+		{"0 \t10/19/2026 3:00:03.000 PM\tApp           Blue Iris is shutting down", false},
+		{"0 \t10/19/2026 3:00:04.000 PM\tDeepStack: started", false},
+		{"0 \t10/19/2026 3:00:05.000 PM\tFrontDoor     Signal: restored", false},
+	}
+
+	for _, tt := range tests {
+		pendingEvents = nil
+		findObject(tt.line)
+
+		start := false
+		for _, e := range pendingEvents {
+			if e.Type == EventServerStart {
+				start = true
+				want := time.Date(2026, 10, 19, 15, 0, 0, 0, time.Local)
+				if e.Time.Truncate(time.Minute) != want || e.Line != tt.line {
+					t.Errorf("%q: event at %v with line %q", tt.line, e.Time, e.Line)
+				}
+			}
+		}
+		if start != tt.start {
+			t.Errorf("%q: server start %v, want %v", tt.line, start, tt.start)
+		}
+	}
+}
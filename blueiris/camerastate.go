@@ -0,0 +1,168 @@
+package blueiris
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+const (
+	CameraUp       = "up"
+	CameraNoSignal = "no_signal"
+	CameraDisabled = "disabled"
+	CameraUnknown  = "unknown"
+)
+
+var CameraStates = []string{CameraUp, CameraNoSignal, CameraDisabled, CameraUnknown}
+
+type cameraInfo struct {
+	state     string
+	detail    string
+	since     time.Time
+	lastEvent time.Time
+}
+
+// LiveCamera is the state of a camera as reported by a live source such as
+// the Blue Iris API.
+type LiveCamera struct {
+	Enabled bool
+	Online  bool
+}
+
+var (
+	cameras     map[string]*cameraInfo = make(map[string]*cameraInfo)
+	cameraStale time.Duration
+
+	// The live state is fetched in the background and kept here, so a slow
+	// live source doesn't hold the parser mutex.
+	cameraLive      map[string]LiveCamera
+	cameraLiveMutex sync.Mutex
+)
+
+// SetCameraSource polls a live source every interval. Its state takes
+// precedence over the state derived from the log, until a poll fails.
+func SetCameraSource(f func() (map[string]LiveCamera, error), interval time.Duration) {
+	poll := func() {
+		live, err := f()
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Unable to get live camera state. Error: %v", err), "console")
+			live = nil
+		}
+		cameraLiveMutex.Lock()
+		cameraLive = live
+		cameraLiveMutex.Unlock()
+	}
+	go func() {
+		for {
+			poll()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// SetCameraStaleAfter marks a camera as unknown when no log event was seen
+// for it within d. Zero disables it.
+func SetCameraStaleAfter(d time.Duration) {
+	cameraStale = d
+}
+
+// touchCamera records a log event of camera that doesn't tell its state,
+// such as a trigger. A quiet camera can't be told from a lost one, so a
+// camera only seen in those lines is unknown.
+func touchCamera(camera string, line string) {
+	c, ok := cameras[camera]
+	if !ok {
+		c = &cameraInfo{state: CameraUnknown, detail: "no signal events", since: logTime(line)}
+		cameras[camera] = c
+	}
+	c.lastEvent = logTime(line)
+}
+
+func setCameraState(camera string, state string, detail string, line string) {
+	c, ok := cameras[camera]
+	if !ok {
+		c = &cameraInfo{}
+		cameras[camera] = c
+	}
+	changed := c.state != state
+	c.state = state
+	c.detail = detail
+	c.lastEvent = logTime(line)
+	if changed {
+		c.since = c.lastEvent
+		emit(Event{Type: EventCameraState, Time: c.lastEvent, Camera: camera, State: state, Detail: detail, Line: line})
+	}
+}
+
+// cameraStates combines the log events with the live source and the stale
+// timeout into the current state of every known camera.
+func cameraStates() map[string]cameraInfo {
+	states := make(map[string]cameraInfo)
+	for name, c := range cameras {
+		s := *c
+		if cameraStale > 0 && time.Since(c.lastEvent) > cameraStale {
+			s.state = CameraUnknown
+			s.detail = "no events for " + cameraStale.String()
+		}
+		states[name] = s
+	}
+
+	cameraLiveMutex.Lock()
+	defer cameraLiveMutex.Unlock()
+	for name, l := range cameraLive {
+		s := states[name]
+		if !l.Enabled {
+			s.state = CameraDisabled
+			s.detail = "disabled"
+		} else if !l.Online {
+			s.state = CameraNoSignal
+			s.detail = "offline"
+		} else {
+			s.state = CameraUp
+			if s.detail == "" {
+				s.detail = "online"
+			}
+		}
+		states[name] = s
+	}
+	return states
+}
+
+var logTimeRegex = regexp.MustCompile(`(\d{1,2})/(\d{1,2})/(\d{4})\s+(\d{1,2}):(\d{2}):(\d{2})(\.\d+)?(\s?[AP]M)?`)
+
+// logTime returns the timestamp of a Blue Iris log line, or the current time
+// if the line has none.
+func logTime(line string) time.Time {
+	m := logTimeRegex.FindStringSubmatch(line)
+	if len(m) == 0 {
+		return time.Now()
+	}
+
+	n := make([]int, 6)
+	for i := range n {
+		n[i], _ = strconv.Atoi(m[i+1])
+	}
+	month, day, year, hour, min, sec := n[0], n[1], n[2], n[3], n[4], n[5]
+
+	var nsec int
+	if m[7] != "" {
+		f, _ := strconv.ParseFloat(m[7], 64)
+		nsec = int(f * float64(time.Second))
+	}
+	switch m[8] {
+	case " PM", "PM":
+		if hour < 12 {
+			hour += 12
+		}
+	case " AM", "AM":
+		if hour == 12 {
+			hour = 0
+		}
+	}
+
+	return time.Date(year, time.Month(month), day, hour, min, sec, nsec, time.Local)
+}
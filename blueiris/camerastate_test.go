@@ -0,0 +1,164 @@
+package blueiris
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// parseLine parses one log line the way readLog does.
+func parseLine(line string) {
+	match, r, matchType := findObject(line)
+	if matchType == "alert" || matchType == "canceled" {
+		parseAI(match, r, matchType, line)
+	}
+}
+
+func resetCameras(t *testing.T) {
+	t.Helper()
+	savedCameras, savedStale := cameras, cameraStale
+	t.Cleanup(func() {
+		cameras, cameraStale = savedCameras, savedStale
+		cameraLiveMutex.Lock()
+		cameraLive = nil
+		cameraLiveMutex.Unlock()
+	})
+	cameras = make(map[string]*cameraInfo)
+	cameraStale = 0
+}
+
+func TestCameraStateFromLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		state  string
+		detail string
+	}{
+		{
+			name:   "trigger only",
+			lines:  []string{"0 \t10/19/2026 3:00:00.000 PM\tFrontDoor     MOTION"},
+			state:  CameraUnknown,
+			detail: "no signal events",
+		},
+		{
+			name:   "AI alert only",
+			lines:  []string{"0 \t10/19/2026 3:00:00.123 PM\tFrontDoor     AI: [Objects] person:87% [12,40 180,320] 123ms"},
+			state:  CameraUnknown,
+			detail: "no signal events",
+		},
+		{
+			name:   "signal lost",
+			lines:  []string{"2 \t10/19/2026 3:00:00.000 PM\tFrontDoor     Signal: network retry"},
+			state:  CameraNoSignal,
+			detail: "network retry",
+		},
+		{
+			// Level 4 signal lines are not a sign of a working camera.
+			name:   "signal lost at level 4",
+			lines:  []string{"4 \t10/19/2026 3:00:00.000 PM\tFrontDoor     Signal: no signal"},
+			state:  CameraNoSignal,
+			detail: "no signal",
+		},
+		{
+			name: "signal restored",
+			lines: []string{
+				"2 \t10/19/2026 3:00:00.000 PM\tFrontDoor     Signal: network retry",
+				"0 \t10/19/2026 3:00:30.000 PM\tFrontDoor     Signal: restored",
+			},
+			state:  CameraUp,
+			detail: "restored",
+		},
+		{
+			name: "trigger keeps the signal state",
+			lines: []string{
+				"2 \t10/19/2026 3:00:00.000 PM\tFrontDoor     Signal: network retry",
+				"0 \t10/19/2026 3:00:10.000 PM\tFrontDoor     MOTION",
+			},
+			state:  CameraNoSignal,
+			detail: "network retry",
+		},
+	}
+
+	for _, tt := range tests {
+		resetCameras(t)
+		for _, line := range tt.lines {
+			parseLine(line)
+		}
+		s, ok := cameraStates()["FrontDoor"]
+		if !ok {
+			t.Errorf("%v: camera not found", tt.name)
+			continue
+		}
+		if s.state != tt.state || s.detail != tt.detail {
+			t.Errorf("%v: state %v (%v), want %v (%v)", tt.name, s.state, s.detail, tt.state, tt.detail)
+		}
+		if want := logTime(tt.lines[len(tt.lines)-1]); !s.lastEvent.Equal(want) {
+			t.Errorf("%v: last event at %v, want %v", tt.name, s.lastEvent, want)
+		}
+	}
+}
+
+func TestCameraStateStale(t *testing.T) {
+	resetCameras(t)
+	SetCameraStaleAfter(10 * time.Minute)
+
+	now := time.Now()
+	recent := now.Add(-time.Minute).Format("01/02/2006 3:04:05.000 PM")
+	old := now.Add(-time.Hour).Format("01/02/2006 3:04:05.000 PM")
+	parseLine("0 \t" + recent + "\tFrontDoor     Signal: restored")
+	parseLine("0 \t" + old + "\tDrive         Signal: restored")
+
+	states := cameraStates()
+	if s := states["FrontDoor"]; s.state != CameraUp {
+		t.Errorf("camera with a recent event is %v, want up", s.state)
+	}
+	if s := states["Drive"]; s.state != CameraUnknown || s.detail != "no events for 10m0s" {
+		t.Errorf("camera without events for an hour is %v (%v), want unknown", s.state, s.detail)
+	}
+
+	// A new event brings it back.
+	parseLine("0 \t" + recent + "\tDrive         MOTION")
+	if s := cameraStates()["Drive"]; s.state != CameraUp {
+		t.Errorf("camera with a new event is %v, want up", s.state)
+	}
+}
+
+func TestCameraStateLive(t *testing.T) {
+	resetCameras(t)
+	parseLine("2 \t10/19/2026 3:00:00.000 PM\tFrontDoor     Signal: network retry")
+	parseLine("0 \t10/19/2026 3:00:00.000 PM\tDrive         Signal: restored")
+
+	// Every poll takes the next result, nil for a failed one.
+	results := make(chan map[string]LiveCamera)
+	SetCameraSource(func() (map[string]LiveCamera, error) {
+		live := <-results
+		if live == nil {
+			return nil, errors.New("connection refused")
+		}
+		return live, nil
+	}, time.Millisecond)
+	waitState := func(name string, want string) {
+		t.Helper()
+		for i := 0; i < 500 && cameraStates()[name].state != want; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if s := cameraStates()[name]; s.state != want {
+			t.Errorf("%v: state %v, want %v", name, s.state, want)
+		}
+	}
+
+	// The live source wins over the log, also for cameras not in the log.
+	results <- map[string]LiveCamera{
+		"FrontDoor": {Enabled: true, Online: true},
+		"Drive":     {Enabled: false},
+		"Garage":    {Enabled: true},
+	}
+	waitState("FrontDoor", CameraUp)
+	waitState("Drive", CameraDisabled)
+	waitState("Garage", CameraNoSignal)
+
+	// After a failed poll the log is used again.
+	results <- nil
+	waitState("FrontDoor", CameraNoSignal)
+	waitState("Drive", CameraUp)
+}
@@ -0,0 +1,81 @@
+package blueiris
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+var (
+	defaultAIProvider         string             = "unknown"
+	aiModuleDuration          map[string]float64 = make(map[string]float64)
+	codeProjectDetectionRegex                    = regexp.MustCompile(`CodeProject\.AI:\s.*\d+%.*\s\d+ms`)
+)
+
+// SetAIProvider sets the ai_provider label for AI lines that don't name the
+// backend, such as the generic "AI:" lines of newer Blue Iris versions.
+func SetAIProvider(provider string) {
+	defaultAIProvider = provider
+}
+
+// aiModel returns the model from the bracketed group of an AI line, or
+// default when the line doesn't name one.
+func aiModel(group string) string {
+	model := strings.TrimSpace(group)
+	if !strings.HasPrefix(model, "[") {
+		return "default"
+	}
+	model = strings.Trim(model, "[]")
+	if model == "" {
+		return "default"
+	}
+	return model
+}
+
+func aiProvider(line string) string {
+	if strings.Contains(line, "CodeProject.AI") {
+		return "codeproject"
+	} else if strings.Contains(line, "DeepStack") {
+		return "deepstack"
+	}
+	return defaultAIProvider
+}
+
+// parseCodeProjectStatus counts the CodeProject.AI status and error lines
+// that aren't detections into the same AI metrics as DeepStack.
+func parseCodeProjectStatus(line string) {
+	l := strings.ToLower(line)
+	provider := "codeproject"
+
+	if strings.Contains(l, "timeout") || strings.Contains(l, "timed out") {
+		aiStatusLine(timeoutcount, provider, aiEventTimeout, line)
+	} else if strings.Contains(l, "not responding") {
+		aiStatusLine(notrespondingcount, provider, aiEventNotResponding, line)
+	} else if strings.Contains(l, "server error") {
+		aiStatusLine(servererrorcount, provider, aiEventServerError, line)
+	} else if strings.Contains(l, "error") || strings.Contains(l, "failed") {
+		aiStatusLine(aiErrorCount, provider, aiEventError, line)
+	} else if strings.Contains(l, "stopped") || strings.Contains(l, "not running") {
+		aiEvent(provider, aiEventStopped, logTime(line), line)
+	} else if strings.Contains(l, "restarted") || strings.Contains(l, "restarting") {
+		aiStatusLine(restartCount, provider, aiEventRestarted, line)
+	} else if strings.Contains(l, "being started") || strings.Contains(l, "starting") {
+		aiStatusLine(aiRestartingCount, provider, aiEventStarting, line)
+	} else if strings.Contains(l, "started") || strings.Contains(l, "is running") {
+		aiStatusLine(aiRestartedCount, provider, aiEventStarted, line)
+	}
+}
+
+// collectProviderCounts sends one sample per AI provider, or a zero for the
+// default provider before any line was seen.
+func collectProviderCounts(ch chan<- prometheus.Metric, sm common.MetricInfo, counts map[string]float64) {
+	if len(counts) == 0 {
+		ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, 0, defaultAIProvider)
+		return
+	}
+	for provider, v := range counts {
+		ch <- prometheus.MustNewConstMetric(sm.Desc, sm.Type, v, provider)
+	}
+}
@@ -0,0 +1,97 @@
+package blueiris
+
+import (
+	"testing"
+)
+
+func resetAI(t *testing.T) {
+	t.Helper()
+	savedServices, savedMetrics, savedModules, savedProvider := aiServices, aiMetrics, aiModuleDuration, defaultAIProvider
+	t.Cleanup(func() {
+		aiServices, aiMetrics, aiModuleDuration, defaultAIProvider = savedServices, savedMetrics, savedModules, savedProvider
+	})
+	aiServices = make(map[string]*aiService)
+	aiMetrics = make(map[string]aidata)
+	aiModuleDuration = make(map[string]float64)
+	resetCameras(t)
+}
+
+func TestCodeProjectStatus(t *testing.T) {
+	tests := []struct {
+		line  string
+		event string
+	}{
+		{"2 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: timeout", aiEventTimeout},
+		{"2 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: request timed out after 15000ms", aiEventTimeout},
+		{"2 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: Server error", aiEventServerError},
+		{"2 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: server error 500 from http://127.0.0.1:32168", aiEventServerError},
+		{"2 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: not responding", aiEventNotResponding},
+		{"2 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: Error: No connection could be made", aiEventError},
+		{"2 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: ObjectDetectionYOLOv5-6.2 failed to start", aiEventError},
+		{"0 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: is being started", aiEventStarting},
+		{"0 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: has been started", aiEventStarted},
+		{"0 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: is running", aiEventStarted},
+		{"0 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: has been restarted", aiEventRestarted},
+		{"0 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: stopped", aiEventStopped},
+		{"0 \t10/19/2026 3:00:00.000 PM\tCodeProject.AI: not running", aiEventStopped},
+	}
+
+	for _, tt := range tests {
+		resetAI(t)
+		parseLine(tt.line)
+
+		if len(aiServices) != 1 || aiServices["codeproject"] == nil {
+			t.Errorf("%q: counted for %v, want codeproject", tt.line, aiServices)
+			continue
+		}
+		events := aiServices["codeproject"].events
+		if len(events) != 1 || events[tt.event] != 1 {
+			t.Errorf("%q: events %v, want %v", tt.line, events, tt.event)
+		}
+		if len(aiMetrics) != 0 {
+			t.Errorf("%q: counted as a detection", tt.line)
+		}
+	}
+}
+
+func TestCodeProjectDetection(t *testing.T) {
+	tests := []struct {
+		line     string
+		provider string
+		model    string
+		camera   string
+		object   string
+		duration float64
+		module   bool
+	}{
+		{"0 \t10/19/2026 3:00:00.123 PM\tFrontDoor     CodeProject.AI: [ipcam-combined] person:87% [12,40 180,320] 123ms", "codeproject", "ipcam-combined", "FrontDoor", "person", 123, true},
+		{"0 \t10/19/2026 3:00:00.123 PM\tDrive         CodeProject.AI: [license-plate] car:91% [0,0 640,480] 2045ms", "codeproject", "license-plate", "Drive", "car", 2045, true},
+		{"0 \t10/19/2026 3:00:00.123 PM\tDrive         CodeProject.AI: car:91% [0,0 640,480] 45ms", "codeproject", "default", "Drive", "car", 45, false},
+		// Newer versions don't name the backend, --ai.provider does.
+		{"0 \t10/19/2026 3:00:00.123 PM\tFrontDoor     AI: [Objects] person:87% [12,40 180,320] 123ms", "cpai", "Objects", "FrontDoor", "person", 123, false},
+		{"0 \t10/19/2026 3:00:00.123 PM\tFrontDoor     DeepStack: person:87% [12,40 180,320] 98ms", "deepstack", "default", "FrontDoor", "person", 98, false},
+	}
+
+	for _, tt := range tests {
+		resetAI(t)
+		SetAIProvider("cpai")
+		parseLine(tt.line)
+
+		a, ok := aiMetrics[tt.camera+"|"+tt.provider+"|"+tt.model+"|alert"]
+		if !ok {
+			t.Errorf("%q: no detection for provider %v and model %v in %v", tt.line, tt.provider, tt.model, aiMetrics)
+			continue
+		}
+		if a.object != tt.object || a.duration != tt.duration {
+			t.Errorf("%q: %v in %vms, want %v in %vms", tt.line, a.object, a.duration, tt.object, tt.duration)
+		}
+		if events := aiServices[tt.provider].events; len(events) != 1 || events[aiEventDetection] != 1 {
+			t.Errorf("%q: events %v, want a detection", tt.line, events)
+		}
+
+		// Only CodeProject.AI lines that name a module time it.
+		if d, ok := aiModuleDuration[tt.model]; ok != tt.module || (ok && d != tt.duration) {
+			t.Errorf("%q: module duration %v, want %v for %v", tt.line, aiModuleDuration, tt.duration, tt.model)
+		}
+	}
+}
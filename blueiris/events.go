@@ -0,0 +1,147 @@
+package blueiris
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+const (
+	EventTrigger     = "trigger"
+	EventAI          = "ai"
+	EventAIStatus    = "ai_status"
+	EventCameraState = "camera_state"
+	EventPush        = "push"
+	EventProfile     = "profile"
+	EventFolder      = "folder"
+	EventError       = "error"
+	EventWarning     = "warning"
+	EventWebLogin    = "web_login"
+	EventWebBan      = "web_ban"
+	EventParseError  = "parse_error"
+	EventServerStart = "server_start"
+
+	// EventLog is sent for every log line, after the events parsed from it.
+	EventLog = "log"
+)
+
+// Event is a change the parser saw in the log. Only the fields that apply to
+// the event type are set.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Camera     string    `json:"camera,omitempty"`
+	Provider   string    `json:"ai_provider,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	Object     string    `json:"object,omitempty"`
+	Result     string    `json:"result,omitempty"`
+	State      string    `json:"state,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	Confidence float64   `json:"confidence,omitempty"`
+	Duration   float64   `json:"duration_ms,omitempty"`
+	Count      float64   `json:"count,omitempty"`
+	Profile    string    `json:"profile,omitempty"`
+	Folder     string    `json:"folder,omitempty"`
+	DiskFree   float64   `json:"disk_free_bytes,omitempty"`
+	FolderUsed float64   `json:"folder_used_percent,omitempty"`
+	HoursUsed  float64   `json:"hours_used_percent,omitempty"`
+	User       string    `json:"user,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	Level      string    `json:"level,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Line       string    `json:"line"`
+
+	// Replay is set for events from the log file that was already there when
+	// the exporter started.
+	Replay bool `json:"replay"`
+}
+
+var (
+	lineRegex     = regexp.MustCompile(`^\s*(?P<source>\S+)\s*(?P<message>.*)$`)
+	eventHandlers []func(Event)
+	pendingEvents []Event
+	replaying     bool
+
+	// deliverMutex is held from taking the pending events until the last
+	// handler returned, so batches drained by different goroutines are
+	// handed over one after the other, in log order.
+	deliverMutex sync.Mutex
+)
+
+// AddEventHandler registers h to be called with every event, in log order.
+// Handlers are called one after the other and must not block. It must be
+// called before the log is first read.
+func AddEventHandler(h func(Event)) {
+	eventHandlers = append(eventHandlers, h)
+}
+
+func emit(e Event) {
+	if len(eventHandlers) == 0 {
+		return
+	}
+	e.Replay = replaying
+	pendingEvents = append(pendingEvents, e)
+}
+
+func emitLine(line string) {
+	if len(eventHandlers) == 0 {
+		return
+	}
+	level := "info"
+	if fields := strings.Fields(line); len(fields) > 0 {
+		switch fields[0] {
+		case "1":
+			level = "warning"
+		case "2":
+			level = "error"
+		}
+	}
+
+	e := Event{Type: EventLog, Time: logTime(line), Level: level, Message: line, Line: line}
+	parts := logTimeRegex.Split(line, 2)
+	if len(parts) == 2 {
+		if m := lineRegex.FindStringSubmatch(parts[1]); len(m) != 0 {
+			e.Source = strings.TrimPrefix(m[lineRegex.SubexpIndex("source")], "\uFEFF")
+			e.Message = strings.TrimSpace(m[lineRegex.SubexpIndex("message")])
+		}
+	}
+	emit(e)
+}
+
+// flushEvents hands the events of the last read to the handlers. It is
+// called without holding the mutex so a handler can't stall the parser.
+func flushEvents() {
+	deliverMutex.Lock()
+	defer deliverMutex.Unlock()
+
+	mutex.Lock()
+	events := pendingEvents
+	pendingEvents = nil
+	mutex.Unlock()
+
+	for _, e := range events {
+		for _, h := range eventHandlers {
+			h(e)
+		}
+	}
+}
+
+// Poll reads the log every interval, so the event handlers see changes
+// without waiting for a scrape.
+func Poll(logpath string, interval time.Duration) {
+	for {
+		mutex.Lock()
+		err := readLog(logpath)
+		mutex.Unlock()
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("BlueIris - Error polling the log. Error: %v", err), "console")
+		}
+		flushEvents()
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,43 @@
+package blueiris
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFlushEventsOrder(t *testing.T) {
+	saved := eventHandlers
+	defer func() { eventHandlers = saved }()
+
+	var got []float64
+	eventHandlers = []func(Event){func(e Event) {
+		// Not locked, the handlers must never be called concurrently.
+		got = append(got, e.Count)
+	}}
+
+	var wg sync.WaitGroup
+	n := 0
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				mutex.Lock()
+				n++
+				emit(Event{Type: EventTrigger, Count: float64(n)})
+				mutex.Unlock()
+				flushEvents()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(got) != 1600 {
+		t.Fatalf("got %v events, want 1600", len(got))
+	}
+	for i, c := range got {
+		if c != float64(i+1) {
+			t.Fatalf("event %v has count %v, events are out of order", i, c)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package blueiris
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	lastTrigger  map[string]time.Time = make(map[string]time.Time)
+	profileSince time.Time
+)
+
+// State is a copy of what the parser knows, built from the same data as the
+// metrics.
+type State struct {
+	Cameras []CameraStatus
+	Folders []FolderStatus
+	AI      []AIProviderStatus
+	Alerts  []AIAlert
+	Profile ProfileStatus
+
+	// LastLine is the time of the last line read from the log.
+	LastLine time.Time
+}
+
+type CameraStatus struct {
+	Name              string     `json:"name"`
+	State             string     `json:"state"`
+	Detail            string     `json:"detail"`
+	Since             *time.Time `json:"since"`
+	LastEvent         *time.Time `json:"last_event"`
+	LastTrigger       *time.Time `json:"last_trigger"`
+	Triggers          float64    `json:"triggers"`
+	AIAlerts          float64    `json:"ai_alerts"`
+	AICanceled        float64    `json:"ai_canceled"`
+	PushNotifications float64    `json:"push_notifications"`
+}
+
+type FolderStatus struct {
+	Name         string  `json:"name"`
+	DiskFree     float64 `json:"disk_free_bytes"`
+	UsedPercent  float64 `json:"used_percent"`
+	HoursPercent float64 `json:"hours_used_percent"`
+}
+
+type AIProviderStatus struct {
+	Provider        string             `json:"ai_provider"`
+	State           string             `json:"state"`
+	Since           *time.Time         `json:"since"`
+	DowntimeSeconds float64            `json:"downtime_seconds"`
+	Events          map[string]float64 `json:"events"`
+	Errors          AIErrorCounts      `json:"errors"`
+}
+
+type AIErrorCounts struct {
+	Timeout       float64 `json:"timeout"`
+	ServerError   float64 `json:"server_error"`
+	NotResponding float64 `json:"not_responding"`
+	Error         float64 `json:"error"`
+	Restarted     float64 `json:"restarted"`
+}
+
+// AIAlert is the last AI result of a camera, type, provider and model.
+type AIAlert struct {
+	Camera   string     `json:"camera"`
+	Type     string     `json:"type"`
+	Provider string     `json:"ai_provider"`
+	Model    string     `json:"model"`
+	Object   string     `json:"object"`
+	Detail   string     `json:"detail"`
+	Duration float64    `json:"duration_ms"`
+	Count    float64    `json:"count"`
+	Time     *time.Time `json:"time"`
+}
+
+type ProfileStatus struct {
+	Current string     `json:"current"`
+	Since   *time.Time `json:"since"`
+}
+
+// Snapshot reads the new lines of the log, as a scrape does, and returns the
+// current state.
+func Snapshot(logpath string) (State, error) {
+	mutex.Lock()
+	err := readLog(logpath)
+	s := snapshot()
+	mutex.Unlock()
+	flushEvents()
+	return s, err
+}
+
+func snapshot() State {
+	s := State{
+		Cameras: []CameraStatus{},
+		Folders: []FolderStatus{},
+		AI:      []AIProviderStatus{},
+		Alerts:  []AIAlert{},
+	}
+
+	counts := make(map[string]*CameraStatus)
+	camera := func(name string) *CameraStatus {
+		c, ok := counts[name]
+		if !ok {
+			c = &CameraStatus{Name: name, State: CameraUnknown}
+			counts[name] = c
+		}
+		return c
+	}
+	for name, c := range cameraStates() {
+		status := camera(name)
+		status.State = c.state
+		status.Detail = c.detail
+		status.Since = timePtr(c.since)
+		status.LastEvent = timePtr(c.lastEvent)
+	}
+	for name, v := range triggerCount {
+		camera(name).Triggers = v
+		camera(name).LastTrigger = timePtr(lastTrigger[name])
+	}
+	for k, v := range pushCount {
+		camera(strings.Split(k, "|")[0]).PushNotifications += v
+	}
+	for k, a := range aiMetrics {
+		if strings.HasSuffix(k, "|alert") {
+			camera(a.camera).AIAlerts += a.alertcount
+		} else if strings.HasSuffix(k, "|canceled") {
+			camera(a.camera).AICanceled += a.alertcount
+		}
+		s.Alerts = append(s.Alerts, AIAlert{
+			Camera:   a.camera,
+			Type:     k[strings.LastIndex(k, "|")+1:],
+			Provider: a.provider,
+			Model:    a.model,
+			Object:   a.object,
+			Detail:   a.detail,
+			Duration: a.duration,
+			Count:    a.alertcount,
+			Time:     timePtr(logTime(a.latest)),
+		})
+	}
+	for _, c := range counts {
+		s.Cameras = append(s.Cameras, *c)
+	}
+	sort.Slice(s.Cameras, func(i, j int) bool { return s.Cameras[i].Name < s.Cameras[j].Name })
+	sort.Slice(s.Alerts, func(i, j int) bool {
+		a, b := s.Alerts[i], s.Alerts[j]
+		return a.Camera+"|"+a.Type+"|"+a.Provider+"|"+a.Model < b.Camera+"|"+b.Type+"|"+b.Provider+"|"+b.Model
+	})
+
+	for name, v := range diskStats {
+		s.Folders = append(s.Folders, FolderStatus{
+			Name:         name,
+			DiskFree:     v["diskfree"],
+			UsedPercent:  v["sizePercent"],
+			HoursPercent: v["hourPercent"],
+		})
+	}
+	sort.Slice(s.Folders, func(i, j int) bool { return s.Folders[i].Name < s.Folders[j].Name })
+
+	providers := make(map[string]bool)
+	for p := range aiServices {
+		providers[p] = true
+	}
+	for _, m := range []map[string]float64{timeoutcount, servererrorcount, notrespondingcount, aiErrorCount, restartCount} {
+		for p := range m {
+			providers[p] = true
+		}
+	}
+	for p := range providers {
+		status := AIProviderStatus{
+			Provider: p,
+			Events:   make(map[string]float64),
+			Errors: AIErrorCounts{
+				Timeout:       timeoutcount[p],
+				ServerError:   servererrorcount[p],
+				NotResponding: notrespondingcount[p],
+				Error:         aiErrorCount[p],
+				Restarted:     restartCount[p],
+			},
+		}
+		if a, ok := aiServices[p]; ok {
+			status.State = a.state
+			status.Since = timePtr(a.since)
+			status.DowntimeSeconds = a.downtimeAt(time.Now())
+			for e, v := range a.events {
+				status.Events[e] = v
+			}
+		}
+		s.AI = append(s.AI, status)
+	}
+	sort.Slice(s.AI, func(i, j int) bool { return s.AI[i].Provider < s.AI[j].Provider })
+
+	for p, v := range profileCount {
+		if v == 1 {
+			s.Profile = ProfileStatus{Current: p, Since: timePtr(profileSince)}
+		}
+	}
+	s.LastLine = logTime(lastLogLine)
+	return s
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,47 @@
+package blueiris
+
+import (
+	"time"
+)
+
+var (
+	lastLogLineNumber int
+	lastRead          time.Time
+	lastReadError     string
+)
+
+// ReadStatus is how far the exporter got reading the log.
+type ReadStatus struct {
+	LogFile         string
+	Line            int
+	LastLine        string
+	LastLineTime    time.Time
+	LastRead        time.Time
+	LastError       string
+	ParseErrors     float64
+	ParseErrorLines int
+}
+
+// Status reads the new lines of the log, as a scrape does, and returns the
+// file and line it is at.
+func Status(logpath string) ReadStatus {
+	mutex.Lock()
+	readLog(logpath)
+	s := ReadStatus{
+		Line:            lastLogLineNumber,
+		LastLine:        lastLogLine,
+		LastRead:        lastRead,
+		LastError:       lastReadError,
+		ParseErrors:     parseErrorsTotal,
+		ParseErrorLines: len(parseErrors),
+	}
+	if lastLogFile != "" {
+		s.LogFile = logpath + lastLogFile
+	}
+	if lastLogLine != "" {
+		s.LastLineTime = logTime(lastLogLine)
+	}
+	mutex.Unlock()
+	flushEvents()
+	return s
+}
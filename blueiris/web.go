@@ -0,0 +1,96 @@
+package blueiris
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	webLoginCount      map[string]float64 = make(map[string]float64)
+	webBanCount        map[string]float64 = make(map[string]float64)
+	webLastFailedLogin float64            = 0
+	webIPLabels        bool               = false
+	webUsers           map[string]bool    = make(map[string]bool)
+	webLoginRegex                         = regexp.MustCompile(`(?i)\blog(?:ged)?\s?in\b`)
+	webBanRegex                           = regexp.MustCompile(`(?i)\bban(?:ned)?\b`)
+	webFailedRegex                        = regexp.MustCompile(`(?i)fail|invalid|denied|incorrect|wrong|bad\s|rejected`)
+	webUserRegex                          = regexp.MustCompile(`(?i)(?:user(?:name)?|login)[:=]?\s+['"]?(?P<user>[^'"\s,:;]+)`)
+	webQuotedUserRegex                    = regexp.MustCompile(`['"](?P<user>[^'"\s]+)['"]`)
+	webUserStopWords                      = map[string]bool{"failed": true, "failure": true, "attempt": true, "from": true, "for": true, "by": true, "ok": true, "successful": true}
+	webIPRegex                            = regexp.MustCompile(`(?P<ip>\b\d{1,3}(?:\.\d{1,3}){3}\b|(?:[0-9a-fA-F]{0,4}:){3,7}[0-9a-fA-F]{0,4})`)
+
+	// webSourceRegex matches the source field of the lines the web server
+	// writes, the web server itself, UI3 or the address of the client.
+	webSourceRegex = regexp.MustCompile(`^\s*(?:(?i:web\s?server|ui3)|\d{1,3}(?:\.\d{1,3}){3}|[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{0,4}){2,7})(?:\s|:|$)`)
+)
+
+// SetIPLabels adds the source IP address as the ip label of the web login and
+// ban metrics. It is off by default to keep the label cardinality bounded.
+func SetIPLabels(enabled bool) {
+	webIPLabels = enabled
+}
+
+// SetWebUsers sets the users that get their own user label on the web login
+// metrics. The user names come from whoever is trying to log in, every other
+// one is counted as "other".
+func SetWebUsers(users []string) {
+	webUsers = make(map[string]bool)
+	for _, u := range users {
+		webUsers[u] = true
+	}
+}
+
+// isWebLine matches the login and ban lines of the web server. The login
+// lines of cameras refusing the credentials of Blue Iris have the camera as
+// their source and are left out.
+func isWebLine(line string) bool {
+	if !webLoginRegex.MatchString(line) && !webBanRegex.MatchString(line) {
+		return false
+	}
+	parts := logTimeRegex.Split(line, 2)
+	return webSourceRegex.MatchString(parts[len(parts)-1])
+}
+
+// parseWebLine counts web server and UI3 logins, failed logins and bans.
+func parseWebLine(line string) {
+	source := ""
+	if m := webIPRegex.FindStringSubmatch(logTimeRegex.ReplaceAllString(line, "")); len(m) != 0 {
+		source = m[webIPRegex.SubexpIndex("ip")]
+	}
+	ip := ""
+	if webIPLabels {
+		ip = source
+	}
+
+	if webBanRegex.MatchString(line) && !webLoginRegex.MatchString(line) {
+		webBanCount[ip]++
+		emit(Event{Type: EventWebBan, Time: logTime(line), IP: source, Line: line})
+		return
+	}
+
+	user := "unknown"
+	if m := webQuotedUserRegex.FindStringSubmatch(line); len(m) != 0 {
+		user = m[webQuotedUserRegex.SubexpIndex("user")]
+	} else {
+		for _, m := range webUserRegex.FindAllStringSubmatch(line, -1) {
+			u := m[webUserRegex.SubexpIndex("user")]
+			if !webUserStopWords[strings.ToLower(u)] && !webIPRegex.MatchString(u) {
+				user = u
+				break
+			}
+		}
+	}
+
+	result := "success"
+	if webFailedRegex.MatchString(line) {
+		result = "failed"
+		webLastFailedLogin = float64(logTime(line).Unix())
+	}
+
+	label := user
+	if user != "unknown" && !webUsers[user] {
+		label = "other"
+	}
+	webLoginCount[label+"|"+result+"|"+ip]++
+	emit(Event{Type: EventWebLogin, Time: logTime(line), User: user, Result: result, IP: source, Line: line})
+}
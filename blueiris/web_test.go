@@ -0,0 +1,57 @@
+package blueiris
+
+import (
+	"testing"
+)
+
+func TestWebLines(t *testing.T) {
+	savedCounts, savedBans, savedUsers := webLoginCount, webBanCount, webUsers
+	defer func() {
+		webLoginCount, webBanCount, webUsers = savedCounts, savedBans, savedUsers
+	}()
+	webLoginCount = make(map[string]float64)
+	webBanCount = make(map[string]float64)
+	SetWebUsers([]string{"admin"})
+
+	tests := []struct {
+		line  string
+		web   bool
+		login string
+	}{
+		{"0 \t10/19/2026 3:00:00.000 PM\t192.168.1.20  Login: admin (UI3)", true, "admin|success|"},
+		{"2 \t10/19/2026 3:00:01.000 PM\tWeb server    Login failed: user 'root' from 203.0.113.9", true, "other|failed|"},
+		{"2 \t10/19/2026 3:00:02.000 PM\tWebServer     Login failed: username x'; DROP TABLE from 203.0.113.9", true, "other|failed|"},
+		{"0 \t10/19/2026 3:00:03.000 PM\tUI3           User \"admin\" logged in from 10.0.0.8", true, "admin|success|"},
+		{"0 \t10/19/2026 3:00:04.000 PM\tfe80::1c:2    Login: viewer", true, "other|success|"},
+		{"2 \t10/19/2026 3:00:05.000 PM\tWeb server    Login failed from 203.0.113.7", true, "unknown|failed|"},
+		{"2 \t10/19/2026 3:00:06.000 PM\tWeb server    203.0.113.9 banned", true, ""},
+		// Cameras refusing the credentials of Blue Iris, also before the
+		// camera was seen in any other line.
+		{"2 \t10/19/2026 3:00:07.000 PM\tNewCam        Login failed, check the credentials", false, ""},
+		{"2 \t10/19/2026 3:00:08.000 PM\tFrontDoor     Login failed (401)", false, ""},
+		{"0 \t10/19/2026 3:00:09.000 PM\tWeb server    Started on port 81", false, ""},
+	}
+
+	for _, tt := range tests {
+		if got := isWebLine(tt.line); got != tt.web {
+			t.Errorf("%q: web line %v, want %v", tt.line, got, tt.web)
+		}
+		if tt.login != "" {
+			before := webLoginCount[tt.login]
+			parseWebLine(tt.line)
+			if webLoginCount[tt.login] != before+1 {
+				t.Errorf("%q: not counted as %v, have %v", tt.line, tt.login, webLoginCount)
+			}
+		}
+	}
+
+	// Whatever users try to log in as, there are only the configured users,
+	// other and unknown.
+	for k := range webLoginCount {
+		switch k {
+		case "admin|success|", "other|success|", "other|failed|", "unknown|failed|":
+		default:
+			t.Errorf("unexpected label set %v", k)
+		}
+	}
+}
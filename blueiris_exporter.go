@@ -1,15 +1,38 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/wymangr/blueiris_exporter/aiprobe"
+	"github.com/wymangr/blueiris_exporter/alertmanager"
+	"github.com/wymangr/blueiris_exporter/api"
+	"github.com/wymangr/blueiris_exporter/archive"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/blueirisapi"
+	"github.com/wymangr/blueiris_exporter/codeprojectai"
 	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+	"github.com/wymangr/blueiris_exporter/grafana"
+	"github.com/wymangr/blueiris_exporter/influxdb"
+	"github.com/wymangr/blueiris_exporter/loki"
+	"github.com/wymangr/blueiris_exporter/mqtt"
+	"github.com/wymangr/blueiris_exporter/otlp"
+	"github.com/wymangr/blueiris_exporter/remotewrite"
+	"github.com/wymangr/blueiris_exporter/statsd"
+	"github.com/wymangr/blueiris_exporter/webhook"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -33,6 +56,9 @@ func (e *ExporterBlueIris) Collect(ch chan<- prometheus.Metric) {
 	for _, m := range e.blueIrisServerMetrics {
 
 		if m.Collect {
+			if e.skipOneShot {
+				m.SecondaryCollect = withoutOneShot(m.SecondaryCollect)
+			}
 			name := m.Name
 			wg.Add(1)
 			go CollectMetrics(&wg, ch, m, name, e.logpath)
@@ -42,11 +68,42 @@ func (e *ExporterBlueIris) Collect(ch chan<- prometheus.Metric) {
 	wg.Wait()
 }
 
-func start(logpath string, metricsPath string, port string) error {
+type options struct {
+	logpath       string
+	metricsPath   string
+	port          string
+	configFile    string
+	apiTarget     string
+	apiModule     string
+	apiEvery      time.Duration
+	staleAfter    time.Duration
+	ipLabels      bool
+	webUsers      []string
+	aiProvider    string
+	cpaiURL       string
+	cpaiTimeout   time.Duration
+	probe         aiProbeOptions
+	pollEvery     time.Duration
+	eventStream   bool
+	textfile      string
+	textfileEvery time.Duration
+	webConfigFile string
+}
+
+type aiProbeOptions struct {
+	url        string
+	interval   time.Duration
+	timeout    time.Duration
+	image      string
+	minObjects int
+}
+
+func start(opts options) error {
 
 	var finalPort string
 	var finalLogpath string
 
+	logpath := opts.logpath
 	if strings.HasSuffix(logpath, `\`) {
 		finalLogpath = logpath
 	} else if strings.HasSuffix(logpath, `/`) {
@@ -59,21 +116,191 @@ func start(logpath string, metricsPath string, port string) error {
 		}
 	}
 
+	c, err := config.LoadFile(opts.configFile)
+	if err != nil {
+		return err
+	}
+	if opts.webConfigFile != "" {
+		err = web.Validate(opts.webConfigFile)
+		if err != nil {
+			return fmt.Errorf("error loading web config file %v: %v", opts.webConfigFile, err)
+		}
+	}
+
+	blueiris.SetCameraStaleAfter(opts.staleAfter)
+	blueiris.SetIPLabels(opts.ipLabels)
+	blueiris.SetWebUsers(opts.webUsers)
+	blueiris.SetAIProvider(opts.aiProvider)
+
+	// ai_duration_distinct is only collected once per sample. The outputs that
+	// gather the metrics use an exporter without it, so they don't take the
+	// samples from /metrics, and share the registry of the other collectors.
 	exporterBlueIris, _ := NewExporterBlueIris(blueIrisServerMetrics, finalLogpath)
+	exporterReg := prometheus.NewRegistry()
+	exporterReg.MustRegister(exporterBlueIris)
+	outputExporter, _ := NewExporterBlueIris(blueIrisServerMetrics, finalLogpath)
+	outputExporter.skipOneShot = true
+	outputReg := prometheus.NewRegistry()
+	outputReg.MustRegister(outputExporter)
 	blueIrisReg := prometheus.NewRegistry()
-	blueIrisReg.MustRegister(exporterBlueIris, promcollectors.NewGoCollector())
+	metricsGatherer := prometheus.Gatherers{exporterReg, blueIrisReg}
+	outputGatherer := prometheus.Gatherers{outputReg, blueIrisReg}
+	if opts.apiTarget != "" {
+		module, ok := c.Modules[opts.apiModule]
+		if !ok {
+			return fmt.Errorf("unknown module %v for --camera.api.target", opts.apiModule)
+		}
+		client := blueirisapi.NewClient(opts.apiTarget, module)
+		blueIrisReg.MustRegister(client)
+		blueiris.SetCameraSource(func() (map[string]blueiris.LiveCamera, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), module.Timeout)
+			defer cancel()
+			cameras, err := client.Cameras(ctx)
+			if err != nil {
+				return nil, err
+			}
+			live := make(map[string]blueiris.LiveCamera)
+			for _, cam := range cameras {
+				live[cam.Name] = blueiris.LiveCamera{Enabled: cam.IsEnabled, Online: cam.IsOnline && !cam.IsNoSignal}
+			}
+			return live, nil
+		}, opts.apiEvery)
+	}
+	if opts.textfile == "" {
+		blueIrisReg.MustRegister(promcollectors.NewGoCollector())
+	}
+	if opts.cpaiURL != "" {
+		blueIrisReg.MustRegister(codeprojectai.NewCollector(opts.cpaiURL, opts.cpaiTimeout))
+	}
+	if opts.probe.url != "" {
+		prober, err := aiprobe.NewProber(opts.probe.url, opts.probe.image, opts.probe.minObjects, opts.probe.timeout)
+		if err != nil {
+			return err
+		}
+		blueIrisReg.MustRegister(prober)
+		go prober.Run(opts.probe.interval)
+	}
+
+	events := false
+	if c.MQTT != nil {
+		publisher := mqtt.NewPublisher(*c.MQTT)
+		blueiris.AddEventHandler(publisher.Handle)
+		publisher.Start()
+		events = true
+	}
+	if c.InfluxDB != nil {
+		writer := influxdb.NewWriter(*c.InfluxDB)
+		blueIrisReg.MustRegister(writer)
+		blueiris.AddEventHandler(writer.Handle)
+		go writer.Run()
+		events = true
+	}
+	if c.Loki != nil {
+		pusher := loki.NewPusher(*c.Loki)
+		blueIrisReg.MustRegister(pusher)
+		blueiris.AddEventHandler(pusher.Handle)
+		go pusher.Run()
+		events = true
+	}
+	if len(c.Webhooks) > 0 {
+		notifier, err := webhook.NewNotifier(c.Webhooks)
+		if err != nil {
+			return err
+		}
+		blueIrisReg.MustRegister(notifier)
+		blueiris.AddEventHandler(notifier.Handle)
+		notifier.Run()
+		events = true
+	}
+	if c.StatsD != nil {
+		emitter := statsd.NewEmitter(*c.StatsD)
+		blueIrisReg.MustRegister(emitter)
+		blueiris.AddEventHandler(emitter.Handle)
+		go emitter.Run()
+		events = true
+	}
+	if c.Archive != nil {
+		sink := archive.NewSink(*c.Archive)
+		blueIrisReg.MustRegister(sink)
+		blueiris.AddEventHandler(sink.Handle)
+		go sink.Run()
+		events = true
+	}
+	if c.Grafana != nil {
+		annotator, err := grafana.NewAnnotator(*c.Grafana)
+		if err != nil {
+			return err
+		}
+		blueIrisReg.MustRegister(annotator)
+		blueiris.AddEventHandler(annotator.Handle)
+		go annotator.Run()
+		events = true
+	}
+	if opts.eventStream {
+		stream := api.NewStream()
+		blueIrisReg.MustRegister(stream)
+		blueiris.AddEventHandler(stream.Handle)
+		http.Handle("/api/events/stream", stream)
+		events = true
+	}
+	if events {
+		go blueiris.Poll(finalLogpath, opts.pollEvery)
+	}
+	if c.Alertmanager != nil {
+		alerter := alertmanager.NewAlerter(*c.Alertmanager, finalLogpath)
+		blueIrisReg.MustRegister(alerter)
+		go alerter.Run()
+	}
+	if c.RemoteWrite != nil {
+		writer := remotewrite.NewWriter(*c.RemoteWrite, outputGatherer)
+		blueIrisReg.MustRegister(writer)
+		go writer.Run()
+	}
+	if c.OTLP != nil {
+		provider, err := otlp.Start(*c.OTLP, outputGatherer)
+		if err != nil {
+			return err
+		}
+		onStop(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), c.OTLP.Timeout)
+			defer cancel()
+			err := provider.Shutdown(ctx)
+			if err != nil {
+				common.BIlogger(fmt.Sprintf("Error exporting the last OTLP metrics. Error: %v", err), "console")
+			}
+		})
+	}
 
-	blueIrisReg.Gather()
+	metricsGatherer.Gather()
 
-	http.Handle(metricsPath, promhttp.HandlerFor(blueIrisReg, promhttp.HandlerOpts{}))
+	if opts.textfile != "" {
+		common.BIlogger(fmt.Sprintf("Writing metrics to %v every %v", opts.textfile, opts.textfileEvery), "info")
+		runTextfile(metricsGatherer, opts.textfile, opts.textfileEvery)
+		return nil
+	}
 
-	if strings.Contains(port, ":") {
-		finalPort = port
+	http.Handle(opts.metricsPath, promhttp.HandlerFor(metricsGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	if len(c.Modules) > 0 {
+		http.Handle("/probe", probeHandler(c, blueirisapi.NewClients()))
+	}
+	http.Handle("/api/", api.NewHandler(finalLogpath))
+	http.HandleFunc("/debug/line", api.LineHandler)
+	if opts.metricsPath != "/" {
+		http.Handle("/", newLandingPage(c, opts, finalLogpath))
+	}
+
+	if strings.Contains(opts.port, ":") {
+		finalPort = opts.port
 	} else {
-		finalPort = ":" + port
+		finalPort = ":" + opts.port
 	}
 	common.BIlogger("Starting Blue Iris Exporter http server", "info")
-	err := http.ListenAndServe(finalPort, nil)
+	systemdSocket := false
+	err = web.ListenAndServe(&http.Server{}, &web.FlagConfig{
+		WebListenAddresses: &[]string{finalPort},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &opts.webConfigFile,
+	}, common.NewSlogLogger())
 	if err != nil {
 		return err
 	}
@@ -85,12 +312,6 @@ func main() {
 	const svcName = "blueiris_exporter"
 	const svcNameLong = "Blue Iris Exporter"
 
-	err := IsService(svcName)
-	if err != nil {
-		common.BIlogger(err.Error(), "error")
-		return
-	}
-
 	var (
 		install = kingpin.Flag(
 			"service.install",
@@ -128,13 +349,143 @@ func main() {
 			"telemetry.path",
 			"URL path for surfacing collected metrics.",
 		).Default("/metrics").String()
+		configFile = kingpin.Flag(
+			"config.file",
+			"Path to the configuration file with the /probe modules and outputs",
+		).Default("").String()
+		apiTarget = kingpin.Flag(
+			"camera.api.target",
+			"Blue Iris web server (host:port) used as the live source for camera_state",
+		).Default("").String()
+		apiModule = kingpin.Flag(
+			"camera.api.module",
+			"Module from --config.file with the credentials for --camera.api.target",
+		).Default("default").String()
+		apiEvery = kingpin.Flag(
+			"camera.api.interval",
+			"How often to get the camera state from --camera.api.target",
+		).Default("15s").Duration()
+		staleAfter = kingpin.Flag(
+			"camera.stale-after",
+			"Report a camera as unknown if there were no log events for it in this long. 0 to disable",
+		).Default("0").Duration()
+		ipLabels = kingpin.Flag(
+			"web.logins.ip-label",
+			"Add the source IP address as a label to the web login and ban metrics",
+		).Default("false").Bool()
+		webUsers = kingpin.Flag(
+			"web.logins.user",
+			"User that gets its own user label on the web login metrics, the others are counted as other. Can be repeated",
+		).Strings()
+		aiProvider = kingpin.Flag(
+			"ai.provider",
+			"ai_provider label for AI log lines that don't name the AI backend, e.g. codeproject or deepstack",
+		).Default("unknown").String()
+		cpaiURL = kingpin.Flag(
+			"codeprojectai.url",
+			"Base URL of the CodeProject.AI server to collect the status from, e.g. http://localhost:32168",
+		).Default("").String()
+		cpaiTimeout = kingpin.Flag(
+			"codeprojectai.timeout",
+			"Timeout for the CodeProject.AI status requests",
+		).Default("5s").Duration()
+		probeURL = kingpin.Flag(
+			"ai.probe.url",
+			"Base URL of a DeepStack or CodeProject.AI server to send a synthetic detection to, e.g. http://localhost:32168",
+		).Default("").String()
+		probeInterval = kingpin.Flag(
+			"ai.probe.interval",
+			"Interval between synthetic AI detections",
+		).Default("1m").Duration()
+		probeTimeout = kingpin.Flag(
+			"ai.probe.timeout",
+			"Timeout for a synthetic AI detection",
+		).Default("10s").Duration()
+		probeImage = kingpin.Flag(
+			"ai.probe.image",
+			"Image to send instead of the bundled test image",
+		).Default("").String()
+		probeMinObjects = kingpin.Flag(
+			"ai.probe.min-objects",
+			"Minimum number of objects the AI must find in the image for the probe to succeed",
+		).Default("0").Int()
+		pollEvery = kingpin.Flag(
+			"events.poll-interval",
+			"How often to read the log for the event outputs such as MQTT, independent of scrapes",
+		).Default("5s").Duration()
+		textfile = kingpin.Flag(
+			"output.textfile",
+			"Write the metrics to this .prom file for the windows_exporter or node_exporter textfile collector instead of serving them over HTTP",
+		).Default("").String()
+		textfileEvery = kingpin.Flag(
+			"output.textfile.interval",
+			"How often to write --output.textfile",
+		).Default("15s").Duration()
+		eventStream = kingpin.Flag(
+			"web.events-stream",
+			"Serve the parsed events as Server-Sent Events on /api/events/stream",
+		).Default("false").Bool()
+		webConfigFile = kingpin.Flag(
+			"web.config.file",
+			"Path to the configuration file that enables TLS or authentication, see https://github.com/prometheus/exporter-toolkit/blob/master/docs/web-configuration.md",
+		).Default("").String()
 	)
 
+	// Services installed by older versions pass the log path, metrics path
+	// and port as positional arguments.
+	args := os.Args[1:]
+	if len(args) == 3 && !strings.HasPrefix(args[0], "-") {
+		args = []string{"--logpath=" + args[0], "--telemetry.path=" + args[1], "--telemetry.addr=" + args[2]}
+	}
+
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	kingpin.MustParse(kingpin.CommandLine.Parse(args))
+
+	opts := options{
+		logpath:     *logpath,
+		metricsPath: *metricsPath,
+		port:        *port,
+		configFile:  *configFile,
+		apiTarget:   *apiTarget,
+		apiModule:   *apiModule,
+		apiEvery:    *apiEvery,
+		staleAfter:  *staleAfter,
+		ipLabels:    *ipLabels,
+		webUsers:    *webUsers,
+		aiProvider:  *aiProvider,
+		cpaiURL:     *cpaiURL,
+		cpaiTimeout: *cpaiTimeout,
+		probe: aiProbeOptions{
+			url:        *probeURL,
+			interval:   *probeInterval,
+			timeout:    *probeTimeout,
+			image:      *probeImage,
+			minObjects: *probeMinObjects,
+		},
+		pollEvery:     *pollEvery,
+		eventStream:   *eventStream,
+		textfile:      *textfile,
+		textfileEvery: *textfileEvery,
+		webConfigFile: *webConfigFile,
+	}
+
+	inService, err := IsService(svcName, opts)
+	if err != nil {
+		common.BIlogger(err.Error(), "error")
+		return
+	}
+	if inService {
+		return
+	}
 
 	if *install {
-		err := installService(svcName, svcNameLong, *logpath, *metricsPath, *port)
+		var svcArgs []string
+		for _, a := range args {
+			if a != "--service.install" {
+				svcArgs = append(svcArgs, a)
+			}
+		}
+		err := installService(svcName, svcNameLong, absPathArgs(svcArgs))
 		if err != nil {
 			common.BIlogger(err.Error(), "error")
 		}
@@ -168,13 +519,81 @@ func main() {
 		var a string = fmt.Sprintf(`Starting Blue Iris Exporter with the following:
 		Log Path: %v
 		Metric Path: %v
-		Port: %v`, *logpath, *metricsPath, *port)
+		Port: %v`, opts.logpath, opts.metricsPath, opts.port)
 		common.BIlogger(a, "info")
 
-		err := start(*logpath, *metricsPath, *port)
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			<-signals
+			stop()
+			os.Exit(0)
+		}()
+		err := start(opts)
 		if err != nil {
 			common.BIlogger(fmt.Sprintf("Error starting blueiris_exporter. err: %v", err), "error")
 		}
+		stop()
 	}
 
 }
+
+var (
+	stopMutex sync.Mutex
+	stopFuncs []func()
+)
+
+// onStop registers f to run before the exporter exits, for the outputs that
+// still hold data.
+func onStop(f func()) {
+	stopMutex.Lock()
+	defer stopMutex.Unlock()
+	stopFuncs = append(stopFuncs, f)
+}
+
+// stop runs the functions registered with onStop once.
+func stop() {
+	stopMutex.Lock()
+	defer stopMutex.Unlock()
+	for _, f := range stopFuncs {
+		f()
+	}
+	stopFuncs = nil
+}
+
+// pathFlags are the flags that take a file path.
+var pathFlags = []string{"--logpath", "--config.file", "--web.config.file", "--ai.probe.image", "--output.textfile"}
+
+// absPathArgs makes the paths of pathFlags absolute, a service doesn't run in
+// the directory it was installed from.
+func absPathArgs(args []string) []string {
+	abs := func(path string) string {
+		if path == "" {
+			return path
+		}
+		a, err := filepath.Abs(path)
+		if err != nil {
+			return path
+		}
+		return a
+	}
+
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		for _, f := range pathFlags {
+			if v, ok := strings.CutPrefix(arg, f+"="); ok {
+				arg = f + "=" + abs(v)
+				break
+			}
+			if arg == f && i+1 < len(args) {
+				out = append(out, arg)
+				i++
+				arg = abs(args[i])
+				break
+			}
+		}
+		out = append(out, arg)
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAbsPathArgs(t *testing.T) {
+	wd, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := func(path string) string { return filepath.Join(wd, path) }
+
+	args := []string{
+		"--config.file=blueiris.yml",
+		"--web.config.file", "web.yml",
+		"--output.textfile=",
+		"--telemetry.addr=:2112",
+		"--logpath", "logs",
+		"--web.config.file",
+	}
+	want := []string{
+		"--config.file=" + abs("blueiris.yml"),
+		"--web.config.file", abs("web.yml"),
+		"--output.textfile=",
+		"--telemetry.addr=:2112",
+		"--logpath", abs("logs"),
+		"--web.config.file",
+	}
+	if got := absPathArgs(args); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+// Package apitest is a Blue Iris JSON API server for tests.
+package apitest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Username and Password are the credentials the server accepts.
+const (
+	Username = "admin"
+	Password = "right"
+)
+
+// Cameras is the camlist of the server, with the Index group first.
+const Cameras = `[
+	{"optionValue": "Index", "optionDisplay": "All cameras", "group": ["Front", "Drive"]},
+	{"optionValue": "Front", "optionDisplay": "Front door", "isEnabled": true, "isOnline": true, "FPS": 15, "nTriggers": 3, "nClips": 2},
+	{"optionValue": "Drive", "optionDisplay": "Driveway", "isEnabled": true, "isNoSignal": true, "nNoSignal": 1}
+]`
+
+// Status is the data of the status command.
+const Status = `{"cpu": 12, "signal": 1, "profile": 2, "lock": 0, "warnings": 0, "alerts": 4}`
+
+// NewServer returns a Blue Iris JSON API that answers every command but
+// login with result, and the number of requests it received.
+func NewServer(t testing.TB, result string) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch {
+		case req["cmd"] == "login" && req["response"] == "":
+			w.Write([]byte(`{"result": "fail", "session": "abc"}`))
+		case req["cmd"] == "login":
+			hash := md5.Sum([]byte(Username + ":abc:" + Password))
+			if req["response"] != hex.EncodeToString(hash[:]) {
+				w.Write([]byte(`{"result": "fail", "data": {"reason": "Authorization failed"}}`))
+				return
+			}
+			w.Write([]byte(`{"result": "success", "session": "abc"}`))
+		case result != "success":
+			w.Write([]byte(`{"result": "` + result + `", "data": {}}`))
+		case req["cmd"] == "status":
+			w.Write([]byte(`{"result": "success", "data": ` + Status + `}`))
+		case req["cmd"] == "camlist":
+			w.Write([]byte(`{"result": "success", "data": ` + Cameras + `}`))
+		default:
+			w.Write([]byte(`{"result": "success", "data": {}}`))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s, &requests
+}
@@ -0,0 +1,264 @@
+package blueirisapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+const (
+	minBackoff = 5 * time.Second
+	maxBackoff = 10 * time.Minute
+
+	// clientIdle is how long a client is kept without being used.
+	clientIdle = time.Hour
+)
+
+var (
+	// errLoginRejected is returned when Blue Iris refused the credentials.
+	errLoginRejected = errors.New("login failed")
+	// errUnavailable is returned when the server couldn't be reached or
+	// answered with a server error.
+	errUnavailable = errors.New("server unavailable")
+)
+
+type Client struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+
+	mutex    sync.Mutex
+	session  string
+	failures int
+	retryAt  time.Time
+
+	loginFailures   prometheus.Counter
+	requestDuration *prometheus.HistogramVec
+}
+
+type response struct {
+	Result  string          `json:"result"`
+	Session string          `json:"session"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func NewClient(target string, module config.Module) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: module.InsecureSkipVerify}
+
+	if !strings.Contains(target, "://") {
+		target = module.Scheme + "://" + target
+	}
+
+	return &Client{
+		url:      strings.TrimSuffix(target, "/") + "/json",
+		username: module.Username,
+		password: module.Password,
+		http:     &http.Client{Transport: transport, Timeout: module.Timeout},
+		loginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_login_failures_total",
+			Help:      "Count of failed logins to the Blue Iris API",
+		}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Duration of Blue Iris API requests by command",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"cmd"}),
+	}
+}
+
+// Command runs cmd on the server, logging in first if there is no session yet.
+// A failed command is retried once with a new session in case the old one
+// expired. Rejected logins and unavailable servers back off exponentially so
+// a wrong password doesn't get the exporter banned or fill the Blue Iris log,
+// and a server that is down isn't waited for on every scrape.
+func (c *Client) Command(ctx context.Context, cmd string, out interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if time.Now().Before(c.retryAt) {
+		return fmt.Errorf("backing off after %v failures, next attempt at %v", c.failures, c.retryAt.Format(time.RFC3339))
+	}
+
+	reused := c.session != ""
+	resp, err := c.command(ctx, cmd)
+	if err == nil && resp.Result != "success" && reused {
+		c.session = ""
+		resp, err = c.command(ctx, cmd)
+	}
+	if errors.Is(err, errLoginRejected) || errors.Is(err, errUnavailable) {
+		c.backoff()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Result != "success" {
+		return fmt.Errorf("%v failed: %v", cmd, reason(resp.Data))
+	}
+
+	c.failures = 0
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+func (c *Client) command(ctx context.Context, cmd string) (*response, error) {
+	if c.session == "" {
+		err := c.login(ctx)
+		if err != nil {
+			c.loginFailures.Inc()
+			return nil, err
+		}
+	}
+	return c.post(ctx, map[string]interface{}{"cmd": cmd, "session": c.session})
+}
+
+// login follows the Blue Iris challenge/response flow: the first call returns
+// a session, the second proves the password with md5(user:session:password).
+func (c *Client) login(ctx context.Context) error {
+	challenge, err := c.post(ctx, map[string]interface{}{"cmd": "login"})
+	if err != nil {
+		return err
+	}
+	if challenge.Session == "" {
+		return errors.New("login did not return a session")
+	}
+
+	hash := md5.Sum([]byte(c.username + ":" + challenge.Session + ":" + c.password))
+	resp, err := c.post(ctx, map[string]interface{}{
+		"cmd":      "login",
+		"session":  challenge.Session,
+		"response": hex.EncodeToString(hash[:]),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Result != "success" {
+		return fmt.Errorf("%w: %v", errLoginRejected, reason(resp.Data))
+	}
+
+	c.session = challenge.Session
+	return nil
+}
+
+func (c *Client) backoff() {
+	c.failures++
+	wait := minBackoff << (c.failures - 1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	c.retryAt = time.Now().Add(wait)
+}
+
+func (c *Client) post(ctx context.Context, body map[string]interface{}) (*response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	res, err := c.http.Do(req)
+	c.requestDuration.WithLabelValues(body["cmd"].(string)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		// The scrape was canceled, not the server.
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 500 {
+		return nil, fmt.Errorf("%w: unexpected status code %v from %v", errUnavailable, res.StatusCode, c.url)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v from %v", res.StatusCode, c.url)
+	}
+
+	resp := &response{}
+	err = json.NewDecoder(res.Body).Decode(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding response from %v: %v", c.url, err)
+	}
+	return resp, nil
+}
+
+// Describe and Collect expose the login failures and request durations of
+// the client.
+func (c *Client) Describe(ch chan<- *prometheus.Desc) {
+	c.loginFailures.Describe(ch)
+	c.requestDuration.Describe(ch)
+}
+
+func (c *Client) Collect(ch chan<- prometheus.Metric) {
+	c.loginFailures.Collect(ch)
+	c.requestDuration.Collect(ch)
+}
+
+func reason(data json.RawMessage) string {
+	var d struct {
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(data, &d) != nil || d.Reason == "" {
+		return "unknown reason"
+	}
+	return d.Reason
+}
+
+// Clients keeps one Client per module and target so sessions are reused
+// between scrapes. Clients that weren't used for clientIdle are removed, so
+// probing arbitrary targets doesn't keep them all.
+type Clients struct {
+	mutex   sync.Mutex
+	clients map[string]*Client
+	used    map[string]time.Time
+}
+
+func NewClients() *Clients {
+	return &Clients{clients: make(map[string]*Client), used: make(map[string]time.Time)}
+}
+
+func (c *Clients) Get(target string, moduleName string, module config.Module) *Client {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for key, used := range c.used {
+		if now.Sub(used) > clientIdle {
+			delete(c.clients, key)
+			delete(c.used, key)
+		}
+	}
+
+	key := moduleName + "|" + target
+	c.used[key] = now
+	if client, ok := c.clients[key]; ok {
+		return client
+	}
+	client := NewClient(target, module)
+	c.clients[key] = client
+	return client
+}
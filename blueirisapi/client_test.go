@@ -0,0 +1,106 @@
+package blueirisapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueirisapi/apitest"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func TestCommandBackoff(t *testing.T) {
+	s, requests := apitest.NewServer(t, "success")
+	c := NewClient(s.URL, config.Module{Username: apitest.Username, Password: "wrong", Timeout: time.Second})
+
+	err := c.Command(context.Background(), "status", nil)
+	if err == nil || !strings.Contains(err.Error(), "Authorization failed") {
+		t.Fatalf("got %v, want the rejected login", err)
+	}
+	n := atomic.LoadInt32(requests)
+
+	// A rejected login backs off without sending anything.
+	err = c.Command(context.Background(), "status", nil)
+	if err == nil || !strings.Contains(err.Error(), "backing off") {
+		t.Errorf("got %v, want backing off", err)
+	}
+	if atomic.LoadInt32(requests) != n {
+		t.Errorf("requests sent while backing off")
+	}
+	if wait := time.Until(c.retryAt); wait <= 0 || wait > minBackoff {
+		t.Errorf("backing off for %v, want up to %v", wait, minBackoff)
+	}
+}
+
+func TestCommandNoBackoff(t *testing.T) {
+	s, _ := apitest.NewServer(t, "fail")
+	c := NewClient(s.URL, config.Module{Username: apitest.Username, Password: apitest.Password, Timeout: time.Second})
+
+	// Failed commands are tried again on the next scrape.
+	for i := 0; i < 2; i++ {
+		err := c.Command(context.Background(), "status", nil)
+		if err == nil || strings.Contains(err.Error(), "backing off") {
+			t.Errorf("got %v, want the failed command", err)
+		}
+	}
+}
+
+func TestCommandUnavailable(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	for _, url := range []string{down.URL, unreachable.URL} {
+		c := NewClient(url, config.Module{Timeout: time.Second})
+		err := c.Command(context.Background(), "status", nil)
+		if !errors.Is(err, errUnavailable) {
+			t.Errorf("%v: got %v, want the server unavailable", url, err)
+		}
+		err = c.Command(context.Background(), "status", nil)
+		if err == nil || !strings.Contains(err.Error(), "backing off") {
+			t.Errorf("%v: got %v, want backing off", url, err)
+		}
+
+		// The backoff doubles with every failure.
+		c.retryAt = time.Time{}
+		c.Command(context.Background(), "status", nil)
+		if wait := time.Until(c.retryAt); wait <= minBackoff || wait > 2*minBackoff {
+			t.Errorf("%v: backing off for %v after 2 failures, want up to %v", url, wait, 2*minBackoff)
+		}
+	}
+
+	// A canceled scrape isn't the server's fault.
+	s, _ := apitest.NewServer(t, "success")
+	c := NewClient(s.URL, config.Module{Username: apitest.Username, Password: apitest.Password, Timeout: time.Second})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Command(ctx, "status", nil)
+	if !c.retryAt.IsZero() {
+		t.Error("backing off after a canceled request")
+	}
+}
+
+func TestClientsExpire(t *testing.T) {
+	clients := NewClients()
+	a := clients.Get("a:81", "default", config.Module{Scheme: "http"})
+	if clients.Get("a:81", "default", config.Module{Scheme: "http"}) != a {
+		t.Error("client not reused")
+	}
+
+	clients.used["default|a:81"] = time.Now().Add(-clientIdle - time.Second)
+	clients.Get("b:81", "default", config.Module{Scheme: "http"})
+	if _, ok := clients.clients["default|a:81"]; ok {
+		t.Error("idle client not removed")
+	}
+	if len(clients.clients) != 1 || len(clients.used) != 1 {
+		t.Errorf("%v clients kept, want 1", len(clients.clients))
+	}
+}
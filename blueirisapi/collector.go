@@ -0,0 +1,161 @@
+package blueirisapi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var namespace string = "blueiris"
+
+type Camera struct {
+	Name        string   `json:"optionValue"`
+	Display     string   `json:"optionDisplay"`
+	Group       []string `json:"group"`
+	IsEnabled   bool     `json:"isEnabled"`
+	IsOnline    bool     `json:"isOnline"`
+	IsNoSignal  bool     `json:"isNoSignal"`
+	IsPaused    bool     `json:"isPaused"`
+	IsTriggered bool     `json:"isTriggered"`
+	IsRecording bool     `json:"isRecording"`
+	IsAlerting  bool     `json:"isAlerting"`
+	FPS         float64  `json:"FPS"`
+	NTriggers   float64  `json:"nTriggers"`
+	NNoSignal   float64  `json:"nNoSignal"`
+	NClips      float64  `json:"nClips"`
+}
+
+type Collector struct {
+	client  *Client
+	up      bool
+	status  map[string]interface{}
+	cameras []Camera
+}
+
+var (
+	upDesc = newDesc("api_up", "Whether the last request to the Blue Iris API succeeded", nil)
+
+	statusFields = map[string]*prometheus.Desc{
+		"cpu":      newDesc("api_cpu_percent", "CPU utilization reported by Blue Iris", nil),
+		"signal":   newDesc("api_signal", "Blue Iris traffic signal. 0=red, 1=green, 2=yellow", nil),
+		"profile":  newDesc("api_profile", "Active Blue Iris profile number", nil),
+		"lock":     newDesc("api_schedule_hold", "Blue Iris schedule hold state. 0=run, 1=hold, 2=temporary", nil),
+		"warnings": newDesc("api_warnings", "Number of warnings reported by Blue Iris", nil),
+		"alerts":   newDesc("api_alerts", "Number of alerts reported by Blue Iris", nil),
+	}
+
+	cameraLabels      = []string{"camera"}
+	cameraEnabledDesc = newDesc("api_camera_enabled", "Camera is enabled in Blue Iris", cameraLabels)
+	cameraOnlineDesc  = newDesc("api_camera_online", "Camera is online in Blue Iris", cameraLabels)
+	cameraNoSigDesc   = newDesc("api_camera_nosignal", "Camera has no signal", cameraLabels)
+	cameraPausedDesc  = newDesc("api_camera_paused", "Camera is paused", cameraLabels)
+	cameraTrigDesc    = newDesc("api_camera_triggered", "Camera is triggered", cameraLabels)
+	cameraRecDesc     = newDesc("api_camera_recording", "Camera is recording", cameraLabels)
+	cameraAlertDesc   = newDesc("api_camera_alerting", "Camera is alerting", cameraLabels)
+	cameraFPSDesc     = newDesc("api_camera_fps", "Current camera frame rate", cameraLabels)
+	cameraTriggers    = newDesc("api_camera_triggers_total", "Camera triggers since Blue Iris started", cameraLabels)
+	cameraNoSignals   = newDesc("api_camera_nosignal_total", "Camera signal losses since Blue Iris started", cameraLabels)
+	cameraClips       = newDesc("api_camera_clips_total", "Camera clips since Blue Iris started", cameraLabels)
+)
+
+func newDesc(name string, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+}
+
+func NewCollector(client *Client) *Collector {
+	return &Collector{client: client}
+}
+
+func (c *Collector) Update(ctx context.Context) error {
+	c.up = false
+
+	status := map[string]interface{}{}
+	err := c.client.Command(ctx, "status", &status)
+	if err != nil {
+		return err
+	}
+
+	cameras, err := c.client.Cameras(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.status = status
+	c.cameras = cameras
+	c.up = true
+	return nil
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upDesc
+	c.client.Describe(ch)
+	for _, d := range statusFields {
+		ch <- d
+	}
+	ch <- cameraEnabledDesc
+	ch <- cameraOnlineDesc
+	ch <- cameraNoSigDesc
+	ch <- cameraPausedDesc
+	ch <- cameraTrigDesc
+	ch <- cameraRecDesc
+	ch <- cameraAlertDesc
+	ch <- cameraFPSDesc
+	ch <- cameraTriggers
+	ch <- cameraNoSignals
+	ch <- cameraClips
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, boolFloat(c.up))
+	c.client.Collect(ch)
+
+	if !c.up {
+		return
+	}
+
+	for field, d := range statusFields {
+		if v, ok := c.status[field].(float64); ok {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+		}
+	}
+
+	for _, cam := range c.cameras {
+		ch <- prometheus.MustNewConstMetric(cameraEnabledDesc, prometheus.GaugeValue, boolFloat(cam.IsEnabled), cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraOnlineDesc, prometheus.GaugeValue, boolFloat(cam.IsOnline), cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraNoSigDesc, prometheus.GaugeValue, boolFloat(cam.IsNoSignal), cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraPausedDesc, prometheus.GaugeValue, boolFloat(cam.IsPaused), cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraTrigDesc, prometheus.GaugeValue, boolFloat(cam.IsTriggered), cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraRecDesc, prometheus.GaugeValue, boolFloat(cam.IsRecording), cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraAlertDesc, prometheus.GaugeValue, boolFloat(cam.IsAlerting), cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraFPSDesc, prometheus.GaugeValue, cam.FPS, cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraTriggers, prometheus.CounterValue, cam.NTriggers, cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraNoSignals, prometheus.CounterValue, cam.NNoSignal, cam.Name)
+		ch <- prometheus.MustNewConstMetric(cameraClips, prometheus.CounterValue, cam.NClips, cam.Name)
+	}
+}
+
+// Cameras returns the cameras from camlist, without the groups.
+func (c *Client) Cameras(ctx context.Context) ([]Camera, error) {
+	var list []Camera
+	err := c.Command(ctx, "camlist", &list)
+	if err != nil {
+		return nil, err
+	}
+
+	var cameras []Camera
+	for _, cam := range list {
+		if len(cam.Group) > 0 || strings.HasPrefix(cam.Name, "@") || cam.Name == "Index" {
+			continue
+		}
+		cameras = append(cameras, cam)
+	}
+	return cameras, nil
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
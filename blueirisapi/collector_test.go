@@ -0,0 +1,68 @@
+package blueirisapi
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wymangr/blueiris_exporter/blueirisapi/apitest"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func TestCollector(t *testing.T) {
+	s, _ := apitest.NewServer(t, "success")
+	c := NewCollector(NewClient(s.URL, config.Module{Username: apitest.Username, Password: apitest.Password, Timeout: time.Second}))
+
+	err := c.Update(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The Index group is not a camera.
+	want := `
+# HELP blueiris_api_camera_nosignal Camera has no signal
+# TYPE blueiris_api_camera_nosignal gauge
+blueiris_api_camera_nosignal{camera="Drive"} 1
+blueiris_api_camera_nosignal{camera="Front"} 0
+# HELP blueiris_api_camera_triggers_total Camera triggers since Blue Iris started
+# TYPE blueiris_api_camera_triggers_total counter
+blueiris_api_camera_triggers_total{camera="Drive"} 0
+blueiris_api_camera_triggers_total{camera="Front"} 3
+# HELP blueiris_api_cpu_percent CPU utilization reported by Blue Iris
+# TYPE blueiris_api_cpu_percent gauge
+blueiris_api_cpu_percent 12
+# HELP blueiris_api_profile Active Blue Iris profile number
+# TYPE blueiris_api_profile gauge
+blueiris_api_profile 2
+# HELP blueiris_api_up Whether the last request to the Blue Iris API succeeded
+# TYPE blueiris_api_up gauge
+blueiris_api_up 1
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(want), "blueiris_api_up", "blueiris_api_cpu_percent", "blueiris_api_profile", "blueiris_api_camera_nosignal", "blueiris_api_camera_triggers_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorDown(t *testing.T) {
+	s, _ := apitest.NewServer(t, "fail")
+	c := NewCollector(NewClient(s.URL, config.Module{Username: apitest.Username, Password: apitest.Password, Timeout: time.Second}))
+
+	err := c.Update(context.Background())
+	if err == nil {
+		t.Fatal("failed status command not returned")
+	}
+
+	// Only the client metrics are left.
+	want := `
+# HELP blueiris_api_up Whether the last request to the Blue Iris API succeeded
+# TYPE blueiris_api_up gauge
+blueiris_api_up 0
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(want), "blueiris_api_up", "blueiris_api_cpu_percent", "blueiris_api_camera_nosignal")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,143 @@
+package codeprojectai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+var namespace string = "blueiris"
+
+type module struct {
+	ModuleID        string                 `json:"moduleId"`
+	Name            string                 `json:"name"`
+	Version         string                 `json:"version"`
+	Status          string                 `json:"status"`
+	InferenceDevice string                 `json:"inferenceDevice"`
+	StatusData      map[string]interface{} `json:"statusData"`
+}
+
+type Collector struct {
+	url     string
+	timeout time.Duration
+	http    *http.Client
+}
+
+var (
+	moduleLabels = []string{"module"}
+	upDesc       = newDesc("codeprojectai_up", "Whether the CodeProject.AI server is responding", nil)
+	installDesc  = newDesc("codeprojectai_module_installed", "CodeProject.AI module is installed", []string{"module", "name", "version"})
+	runningDesc  = newDesc("codeprojectai_module_running", "CodeProject.AI module is running", moduleLabels)
+	inferDesc    = newDesc("codeprojectai_module_inferences_total", "Count of inferences run by the CodeProject.AI module", moduleLabels)
+	avgDesc      = newDesc("codeprojectai_module_inference_ms", "Average inference time of the CodeProject.AI module in ms", moduleLabels)
+	deviceDesc   = newDesc("codeprojectai_module_inference_device", "Device the CodeProject.AI module runs its inference on", []string{"module", "device"})
+	scrapeDesc   = newDesc("codeprojectai_scrape_duration_seconds", "Duration of the CodeProject.AI status requests", nil)
+)
+
+func newDesc(name string, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+}
+
+func NewCollector(url string, timeout time.Duration) *Collector {
+	return &Collector{
+		url:     strings.TrimSuffix(url, "/"),
+		timeout: timeout,
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upDesc
+	ch <- installDesc
+	ch <- runningDesc
+	ch <- inferDesc
+	ch <- avgDesc
+	ch <- deviceDesc
+	ch <- scrapeDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(scrapeDesc, prometheus.GaugeValue, time.Since(start).Seconds())
+	}()
+
+	err := c.get(ctx, "/v1/server/status/ping", nil)
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("CodeProject.AI - Error pinging server. Error: %v", err), "console")
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1)
+
+	var installed struct {
+		Modules []module `json:"modules"`
+	}
+	err = c.get(ctx, "/v1/module/list/installed", &installed)
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("CodeProject.AI - Error listing installed modules. Error: %v", err), "console")
+	}
+	for _, m := range installed.Modules {
+		ch <- prometheus.MustNewConstMetric(installDesc, prometheus.GaugeValue, 1, m.ModuleID, m.Name, m.Version)
+	}
+
+	var status struct {
+		Statuses []module `json:"statuses"`
+	}
+	err = c.get(ctx, "/v1/module/list/status", &status)
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("CodeProject.AI - Error getting module status. Error: %v", err), "console")
+		return
+	}
+	for _, m := range status.Statuses {
+		running := 0.0
+		if strings.EqualFold(m.Status, "Started") || strings.EqualFold(m.Status, "Running") {
+			running = 1
+		}
+		ch <- prometheus.MustNewConstMetric(runningDesc, prometheus.GaugeValue, running, m.ModuleID)
+
+		if v, ok := m.StatusData["numInferences"].(float64); ok {
+			ch <- prometheus.MustNewConstMetric(inferDesc, prometheus.CounterValue, v, m.ModuleID)
+		}
+		if v, ok := m.StatusData["averageInferenceMs"].(float64); ok {
+			ch <- prometheus.MustNewConstMetric(avgDesc, prometheus.GaugeValue, v, m.ModuleID)
+		}
+
+		device := m.InferenceDevice
+		if d, ok := m.StatusData["inferenceDevice"].(string); ok && d != "" {
+			device = d
+		}
+		if device != "" {
+			ch <- prometheus.MustNewConstMetric(deviceDesc, prometheus.GaugeValue, 1, m.ModuleID, device)
+		}
+	}
+}
+
+func (c *Collector) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %v from %v", res.StatusCode, c.url+path)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,118 @@
+package codeprojectai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const installedResponse = `{
+  "success": true,
+  "modules": [
+    {"moduleId": "ObjectDetectionYOLOv5Net", "name": "Object Detection (YOLOv5 .NET)", "version": "1.10.1", "status": "Started"},
+    {"moduleId": "FaceProcessing", "name": "Face Processing", "version": "1.9.0", "status": "NotEnabled"}
+  ]
+}`
+
+const statusResponse = `{
+  "success": true,
+  "statuses": [
+    {
+      "moduleId": "ObjectDetectionYOLOv5Net",
+      "status": "Started",
+      "inferenceDevice": "CPU",
+      "statusData": {"numInferences": 1234, "averageInferenceMs": 87.5, "inferenceDevice": "GPU (DirectML)"}
+    },
+    {
+      "moduleId": "FaceProcessing",
+      "status": "NotEnabled",
+      "inferenceDevice": "CPU",
+      "statusData": {}
+    }
+  ]
+}`
+
+func newServer(t *testing.T, ping int) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/server/status/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(ping)
+	})
+	mux.HandleFunc("/v1/module/list/installed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(installedResponse))
+	})
+	mux.HandleFunc("/v1/module/list/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(statusResponse))
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCollector(t *testing.T) {
+	s := newServer(t, http.StatusOK)
+	c := NewCollector(s.URL+"/", time.Second)
+
+	want := `
+# HELP blueiris_codeprojectai_up Whether the CodeProject.AI server is responding
+# TYPE blueiris_codeprojectai_up gauge
+blueiris_codeprojectai_up 1
+# HELP blueiris_codeprojectai_module_installed CodeProject.AI module is installed
+# TYPE blueiris_codeprojectai_module_installed gauge
+blueiris_codeprojectai_module_installed{module="FaceProcessing",name="Face Processing",version="1.9.0"} 1
+blueiris_codeprojectai_module_installed{module="ObjectDetectionYOLOv5Net",name="Object Detection (YOLOv5 .NET)",version="1.10.1"} 1
+# HELP blueiris_codeprojectai_module_running CodeProject.AI module is running
+# TYPE blueiris_codeprojectai_module_running gauge
+blueiris_codeprojectai_module_running{module="FaceProcessing"} 0
+blueiris_codeprojectai_module_running{module="ObjectDetectionYOLOv5Net"} 1
+# HELP blueiris_codeprojectai_module_inferences_total Count of inferences run by the CodeProject.AI module
+# TYPE blueiris_codeprojectai_module_inferences_total counter
+blueiris_codeprojectai_module_inferences_total{module="ObjectDetectionYOLOv5Net"} 1234
+# HELP blueiris_codeprojectai_module_inference_ms Average inference time of the CodeProject.AI module in ms
+# TYPE blueiris_codeprojectai_module_inference_ms gauge
+blueiris_codeprojectai_module_inference_ms{module="ObjectDetectionYOLOv5Net"} 87.5
+# HELP blueiris_codeprojectai_module_inference_device Device the CodeProject.AI module runs its inference on
+# TYPE blueiris_codeprojectai_module_inference_device gauge
+blueiris_codeprojectai_module_inference_device{device="CPU",module="FaceProcessing"} 1
+blueiris_codeprojectai_module_inference_device{device="GPU (DirectML)",module="ObjectDetectionYOLOv5Net"} 1
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"blueiris_codeprojectai_up",
+		"blueiris_codeprojectai_module_installed",
+		"blueiris_codeprojectai_module_running",
+		"blueiris_codeprojectai_module_inferences_total",
+		"blueiris_codeprojectai_module_inference_ms",
+		"blueiris_codeprojectai_module_inference_device",
+	)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorPingFailure(t *testing.T) {
+	for name, url := range map[string]string{
+		"error status": newServer(t, http.StatusServiceUnavailable).URL,
+		"unreachable":  "http://127.0.0.1:1",
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewCollector(url, time.Second)
+
+			want := `
+# HELP blueiris_codeprojectai_up Whether the CodeProject.AI server is responding
+# TYPE blueiris_codeprojectai_up gauge
+blueiris_codeprojectai_up 0
+`
+			err := testutil.CollectAndCompare(c, strings.NewReader(want), "blueiris_codeprojectai_up")
+			if err != nil {
+				t.Error(err)
+			}
+			if n := testutil.CollectAndCount(c); n != 2 {
+				t.Errorf("collected %v metrics, want up and the scrape duration", n)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 type MetricInfo struct {
 	Desc             *prometheus.Desc
 	Type             prometheus.ValueType
+	Histogram        bool
 	Name             string
 	Collect          bool
 	SecondaryCollect []int
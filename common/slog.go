@@ -0,0 +1,49 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// NewSlogLogger returns a logger for libraries that log with slog, writing
+// through BIlogger so their messages end up in the same place as ours.
+func NewSlogLogger() *slog.Logger {
+	return slog.New(&slogHandler{})
+}
+
+type slogHandler struct {
+	attrs []slog.Attr
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	write := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %v=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+
+	level := "info"
+	if r.Level >= slog.LevelWarn {
+		level = "error"
+	}
+	return BIlogger(b.String(), level)
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &slogHandler{attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *slogHandler) WithGroup(string) slog.Handler {
+	return h
+}
@@ -0,0 +1,515 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Modules      map[string]Module `yaml:"modules"`
+	MQTT         *MQTT             `yaml:"mqtt"`
+	RemoteWrite  *RemoteWrite      `yaml:"remote_write"`
+	OTLP         *OTLP             `yaml:"otlp"`
+	InfluxDB     *InfluxDB         `yaml:"influxdb"`
+	Loki         *Loki             `yaml:"loki"`
+	Webhooks     []Webhook         `yaml:"webhooks"`
+	StatsD       *StatsD           `yaml:"statsd"`
+	Archive      *Archive          `yaml:"archive"`
+	Alertmanager *Alertmanager     `yaml:"alertmanager"`
+	Grafana      *Grafana          `yaml:"grafana"`
+}
+
+type Module struct {
+	Username           string        `yaml:"username"`
+	UsernameFile       string        `yaml:"username_file"`
+	UsernameEnv        string        `yaml:"username_env"`
+	Password           string        `yaml:"password"`
+	PasswordFile       string        `yaml:"password_file"`
+	PasswordEnv        string        `yaml:"password_env"`
+	Scheme             string        `yaml:"scheme"`
+	Timeout            time.Duration `yaml:"timeout"`
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+}
+
+type MQTT struct {
+	Broker           string `yaml:"broker"`
+	ClientID         string `yaml:"client_id"`
+	Username         string `yaml:"username"`
+	UsernameFile     string `yaml:"username_file"`
+	UsernameEnv      string `yaml:"username_env"`
+	Password         string `yaml:"password"`
+	PasswordFile     string `yaml:"password_file"`
+	PasswordEnv      string `yaml:"password_env"`
+	TopicPrefix      string `yaml:"topic_prefix"`
+	DiscoveryPrefix  string `yaml:"discovery_prefix"`
+	DisableDiscovery bool   `yaml:"disable_discovery"`
+	QoS              byte   `yaml:"qos"`
+}
+
+type RemoteWrite struct {
+	Interval       time.Duration         `yaml:"interval"`
+	ExternalLabels map[string]string     `yaml:"external_labels"`
+	Endpoints      []RemoteWriteEndpoint `yaml:"endpoints"`
+}
+
+type RemoteWriteEndpoint struct {
+	Name       string `yaml:"name"`
+	URL        string `yaml:"url"`
+	QueueSize  int    `yaml:"queue_size"`
+	HTTPClient `yaml:",inline"`
+}
+
+type OTLP struct {
+	Protocol           string            `yaml:"protocol"`
+	Endpoint           string            `yaml:"endpoint"`
+	Interval           time.Duration     `yaml:"interval"`
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	HTTPClient         `yaml:",inline"`
+}
+
+type InfluxDB struct {
+	URL           string        `yaml:"url"`
+	Org           string        `yaml:"org"`
+	Bucket        string        `yaml:"bucket"`
+	Token         string        `yaml:"token"`
+	TokenFile     string        `yaml:"token_file"`
+	TokenEnv      string        `yaml:"token_env"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	MaxBuffer     int           `yaml:"max_buffer"`
+	HTTPClient    `yaml:",inline"`
+}
+
+type Loki struct {
+	URL           string            `yaml:"url"`
+	Labels        map[string]string `yaml:"labels"`
+	BatchSize     int               `yaml:"batch_size"`
+	FlushInterval time.Duration     `yaml:"flush_interval"`
+	MaxBuffer     int               `yaml:"max_buffer"`
+	IncludeReplay bool              `yaml:"include_replay"`
+	HTTPClient    `yaml:",inline"`
+}
+
+type Webhook struct {
+	Name          string            `yaml:"name"`
+	URL           string            `yaml:"url"`
+	Method        string            `yaml:"method"`
+	Events        []string          `yaml:"events"`
+	Filter        map[string]string `yaml:"filter"`
+	When          string            `yaml:"when"`
+	Body          string            `yaml:"body"`
+	RateLimit     time.Duration     `yaml:"rate_limit"`
+	RateLimitKey  string            `yaml:"rate_limit_key"`
+	Retries       *int              `yaml:"retries"`
+	IncludeReplay bool              `yaml:"include_replay"`
+	HTTPClient    `yaml:",inline"`
+}
+
+type StatsD struct {
+	Address       string        `yaml:"address"`
+	Prefix        string        `yaml:"prefix"`
+	DogStatsD     bool          `yaml:"dogstatsd"`
+	Tags          []string      `yaml:"tags"`
+	SampleRate    float64       `yaml:"sample_rate"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	MaxPacketSize int           `yaml:"max_packet_size"`
+}
+
+type Archive struct {
+	Path          string        `yaml:"path"`
+	Format        string        `yaml:"format"`
+	MaxSizeMB     int           `yaml:"max_size_mb"`
+	MaxAge        time.Duration `yaml:"max_age"`
+	MaxFiles      int           `yaml:"max_files"`
+	Compress      bool          `yaml:"compress"`
+	IncludeReplay bool          `yaml:"include_replay"`
+}
+
+type Alertmanager struct {
+	URL                   string            `yaml:"url"`
+	Interval              time.Duration     `yaml:"interval"`
+	Labels                map[string]string `yaml:"labels"`
+	GeneratorURL          string            `yaml:"generator_url"`
+	CameraDownFor         time.Duration     `yaml:"camera_down_for"`
+	AIFailingFor          time.Duration     `yaml:"ai_failing_for"`
+	FolderDiskFreeBelowGB float64           `yaml:"folder_disk_free_below_gb"`
+	LogStaleFor           time.Duration     `yaml:"log_stale_for"`
+	Disable               []string          `yaml:"disable"`
+	HTTPClient            `yaml:",inline"`
+}
+
+type Grafana struct {
+	URL          string   `yaml:"url"`
+	DashboardUID string   `yaml:"dashboard_uid"`
+	PanelID      int      `yaml:"panel_id"`
+	Tags         []string `yaml:"tags"`
+	Events       []string `yaml:"events"`
+	PositionFile string   `yaml:"position_file"`
+	Retries      *int     `yaml:"retries"`
+	HTTPClient   `yaml:",inline"`
+}
+
+func LoadFile(path string) (*Config, error) {
+	c := &Config{}
+	if path == "" {
+		return c, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %v: %v", path, err)
+	}
+
+	err = yaml.Unmarshal(content, c)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %v: %v", path, err)
+	}
+
+	for name, m := range c.Modules {
+		if m.Scheme == "" {
+			m.Scheme = "http"
+		}
+		if m.Scheme != "http" && m.Scheme != "https" {
+			return nil, fmt.Errorf("module %v: invalid scheme %v", name, m.Scheme)
+		}
+		if m.Timeout == 0 {
+			m.Timeout = 10 * time.Second
+		}
+		m.Username, err = secret(m.Username, m.UsernameFile, m.UsernameEnv)
+		if err != nil {
+			return nil, fmt.Errorf("module %v: %v", name, err)
+		}
+		m.Password, err = secret(m.Password, m.PasswordFile, m.PasswordEnv)
+		if err != nil {
+			return nil, fmt.Errorf("module %v: %v", name, err)
+		}
+		c.Modules[name] = m
+	}
+
+	if c.MQTT != nil {
+		err = c.MQTT.load()
+		if err != nil {
+			return nil, fmt.Errorf("mqtt: %v", err)
+		}
+	}
+
+	if c.RemoteWrite != nil {
+		err = c.RemoteWrite.load()
+		if err != nil {
+			return nil, fmt.Errorf("remote_write: %v", err)
+		}
+	}
+
+	if c.OTLP != nil {
+		err = c.OTLP.load()
+		if err != nil {
+			return nil, fmt.Errorf("otlp: %v", err)
+		}
+	}
+
+	if c.InfluxDB != nil {
+		err = c.InfluxDB.load()
+		if err != nil {
+			return nil, fmt.Errorf("influxdb: %v", err)
+		}
+	}
+
+	if c.Loki != nil {
+		err = c.Loki.load()
+		if err != nil {
+			return nil, fmt.Errorf("loki: %v", err)
+		}
+	}
+
+	for i := range c.Webhooks {
+		err = c.Webhooks[i].load()
+		if err != nil {
+			return nil, fmt.Errorf("webhook %v: %v", c.Webhooks[i].Name, err)
+		}
+	}
+
+	if c.StatsD != nil {
+		err = c.StatsD.load()
+		if err != nil {
+			return nil, fmt.Errorf("statsd: %v", err)
+		}
+	}
+
+	if c.Archive != nil {
+		err = c.Archive.load()
+		if err != nil {
+			return nil, fmt.Errorf("archive: %v", err)
+		}
+	}
+
+	if c.Alertmanager != nil {
+		err = c.Alertmanager.load()
+		if err != nil {
+			return nil, fmt.Errorf("alertmanager: %v", err)
+		}
+	}
+
+	if c.Grafana != nil {
+		err = c.Grafana.load()
+		if err != nil {
+			return nil, fmt.Errorf("grafana: %v", err)
+		}
+	}
+
+	return c, nil
+}
+
+func (g *Grafana) load() error {
+	if g.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if len(g.Tags) == 0 {
+		g.Tags = []string{"blueiris"}
+	}
+	if len(g.Events) == 0 {
+		g.Events = []string{"profile", "ai_restart", "server_start", "camera_signal_lost"}
+	}
+	for _, e := range g.Events {
+		switch e {
+		case "profile", "ai_restart", "server_start", "camera_signal_lost":
+		default:
+			return fmt.Errorf("invalid event %v, must be profile, ai_restart, server_start or camera_signal_lost", e)
+		}
+	}
+	if g.PositionFile == "" {
+		g.PositionFile = filepath.Join(os.TempDir(), "blueiris_exporter_grafana.json")
+	}
+	if g.Retries == nil {
+		retries := 3
+		g.Retries = &retries
+	}
+	return g.HTTPClient.load()
+}
+
+func (a *Alertmanager) load() error {
+	if a.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if a.Interval == 0 {
+		a.Interval = time.Minute
+	}
+	if a.CameraDownFor == 0 {
+		a.CameraDownFor = 10 * time.Minute
+	}
+	if a.AIFailingFor == 0 {
+		a.AIFailingFor = 5 * time.Minute
+	}
+	if a.FolderDiskFreeBelowGB == 0 {
+		a.FolderDiskFreeBelowGB = 10
+	}
+	if a.LogStaleFor == 0 {
+		a.LogStaleFor = 15 * time.Minute
+	}
+	for _, rule := range a.Disable {
+		switch rule {
+		case "camera_down", "ai_failing", "folder_disk_free", "log_stale":
+		default:
+			return fmt.Errorf("invalid rule %v in disable, must be camera_down, ai_failing, folder_disk_free or log_stale", rule)
+		}
+	}
+	return a.HTTPClient.load()
+}
+
+func (a *Archive) load() error {
+	if a.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if a.Format == "" {
+		a.Format = "ndjson"
+	}
+	if a.Format != "ndjson" && a.Format != "csv" {
+		return fmt.Errorf("invalid format %v, must be ndjson or csv", a.Format)
+	}
+	if a.MaxSizeMB == 0 {
+		a.MaxSizeMB = 100
+	}
+	if a.MaxFiles == 0 {
+		a.MaxFiles = 10
+	}
+	return nil
+}
+
+func (s *StatsD) load() error {
+	if s.Address == "" {
+		s.Address = "127.0.0.1:8125"
+	}
+	if s.Prefix == "" {
+		s.Prefix = "blueiris."
+	}
+	if s.SampleRate == 0 {
+		s.SampleRate = 1
+	}
+	if s.SampleRate < 0 || s.SampleRate > 1 {
+		return fmt.Errorf("invalid sample_rate %v", s.SampleRate)
+	}
+	if s.FlushInterval == 0 {
+		s.FlushInterval = time.Second
+	}
+	if s.MaxPacketSize == 0 {
+		s.MaxPacketSize = 1432
+	}
+	return nil
+}
+
+func (w *Webhook) load() error {
+	if w.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if w.Name == "" {
+		w.Name = w.URL
+	}
+	if w.Method == "" {
+		w.Method = "POST"
+	}
+	if w.RateLimitKey == "" {
+		w.RateLimitKey = "{{ .Type }}|{{ .Camera }}|{{ .Provider }}|{{ .Folder }}|{{ .State }}|{{ .Result }}"
+	}
+	if w.Retries == nil {
+		retries := 3
+		w.Retries = &retries
+	}
+	return w.HTTPClient.load()
+}
+
+func (l *Loki) load() error {
+	if l.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if len(l.Labels) == 0 {
+		l.Labels = map[string]string{"job": "blue_iris"}
+	}
+	if l.BatchSize == 0 {
+		l.BatchSize = 1000
+	}
+	if l.FlushInterval == 0 {
+		l.FlushInterval = time.Second
+	}
+	if l.MaxBuffer == 0 {
+		l.MaxBuffer = 10000
+	}
+	return l.HTTPClient.load()
+}
+
+func (i *InfluxDB) load() error {
+	if i.URL == "" || i.Org == "" || i.Bucket == "" {
+		return fmt.Errorf("url, org and bucket are required")
+	}
+	if i.BatchSize == 0 {
+		i.BatchSize = 500
+	}
+	if i.FlushInterval == 0 {
+		i.FlushInterval = 10 * time.Second
+	}
+	if i.MaxBuffer == 0 {
+		i.MaxBuffer = 10000
+	}
+
+	var err error
+	i.Token, err = secret(i.Token, i.TokenFile, i.TokenEnv)
+	if err != nil {
+		return err
+	}
+	return i.HTTPClient.load()
+}
+
+func (o *OTLP) load() error {
+	switch o.Protocol {
+	case "", "grpc":
+		o.Protocol = "grpc"
+		if o.Endpoint == "" {
+			o.Endpoint = "http://localhost:4317"
+		}
+	case "http":
+		if o.Endpoint == "" {
+			o.Endpoint = "http://localhost:4318/v1/metrics"
+		}
+	default:
+		return fmt.Errorf("invalid protocol %v, must be grpc or http", o.Protocol)
+	}
+	if o.Interval == 0 {
+		o.Interval = 30 * time.Second
+	}
+	return o.HTTPClient.load()
+}
+
+func (r *RemoteWrite) load() error {
+	if r.Interval == 0 {
+		r.Interval = 30 * time.Second
+	}
+	if len(r.Endpoints) == 0 {
+		return fmt.Errorf("at least one endpoint is required")
+	}
+	for i := range r.Endpoints {
+		e := &r.Endpoints[i]
+		if e.URL == "" {
+			return fmt.Errorf("endpoint %v: url is required", i)
+		}
+		if e.Name == "" {
+			e.Name = e.URL
+		}
+		if e.QueueSize == 0 {
+			e.QueueSize = 10
+		}
+		err := e.HTTPClient.load()
+		if err != nil {
+			return fmt.Errorf("endpoint %v: %v", e.Name, err)
+		}
+	}
+	return nil
+}
+
+func (m *MQTT) load() error {
+	if m.Broker == "" {
+		return fmt.Errorf("broker is required")
+	}
+	if m.ClientID == "" {
+		m.ClientID = "blueiris_exporter"
+	}
+	if m.TopicPrefix == "" {
+		m.TopicPrefix = "blueiris"
+	}
+	if m.DiscoveryPrefix == "" {
+		m.DiscoveryPrefix = "homeassistant"
+	}
+	if m.QoS > 2 {
+		return fmt.Errorf("invalid qos %v", m.QoS)
+	}
+
+	var err error
+	m.Username, err = secret(m.Username, m.UsernameFile, m.UsernameEnv)
+	if err != nil {
+		return err
+	}
+	m.Password, err = secret(m.Password, m.PasswordFile, m.PasswordEnv)
+	return err
+}
+
+// secret resolves a credential from, in order of preference, a file, an
+// environment variable or the value written in the config file.
+func secret(value string, file string, env string) (string, error) {
+	if file != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("error reading %v: %v", file, err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+	if env != "" {
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %v is not set", env)
+		}
+		return v, nil
+	}
+	return value, nil
+}
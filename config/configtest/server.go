@@ -0,0 +1,85 @@
+// Package configtest has the server the outputs that push over HTTP are
+// tested against.
+package configtest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Request is a request the server got.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// NewServer answers with the statuses in order and 204 after them. The
+// requests it got are passed on the returned channel before they're
+// answered.
+func NewServer(t testing.TB, statuses ...int) (*httptest.Server, chan Request) {
+	t.Helper()
+	requests := make(chan Request, 100)
+	var mu sync.Mutex
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		requests <- Request{Method: r.Method, URL: r.URL, Header: r.Header, Body: body}
+
+		mu.Lock()
+		status := http.StatusNoContent
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s, requests
+}
+
+// Next returns the next request, failing the test if none comes.
+func Next(t testing.TB, requests chan Request) Request {
+	t.Helper()
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(10 * time.Second):
+		t.Fatal("no request received")
+	}
+	return Request{}
+}
+
+// None fails the test if another request comes.
+func None(t testing.TB, requests chan Request) {
+	t.Helper()
+	select {
+	case r := <-requests:
+		t.Errorf("unexpected request %v %v: %s", r.Method, r.URL, r.Body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// WaitFor waits for a metric to reach want. Outputs count after the response
+// is read, so it can lag behind the request.
+func WaitFor(t testing.TB, c prometheus.Collector, want float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(c) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("metric is %v, want %v", testutil.ToFloat64(c), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
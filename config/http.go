@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const maxBackoff = time.Minute
+
+// HTTPClient holds the options shared by the outputs that push over HTTP.
+type HTTPClient struct {
+	BasicAuth          *BasicAuth        `yaml:"basic_auth"`
+	BearerToken        string            `yaml:"bearer_token"`
+	BearerTokenFile    string            `yaml:"bearer_token_file"`
+	BearerTokenEnv     string            `yaml:"bearer_token_env"`
+	Headers            map[string]string `yaml:"headers"`
+	Timeout            time.Duration     `yaml:"timeout"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`
+}
+
+type BasicAuth struct {
+	Username     string `yaml:"username"`
+	UsernameFile string `yaml:"username_file"`
+	UsernameEnv  string `yaml:"username_env"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+	PasswordEnv  string `yaml:"password_env"`
+}
+
+func (h *HTTPClient) load() error {
+	if h.Timeout == 0 {
+		h.Timeout = 30 * time.Second
+	}
+
+	var err error
+	h.BearerToken, err = secret(h.BearerToken, h.BearerTokenFile, h.BearerTokenEnv)
+	if err != nil {
+		return err
+	}
+	if h.BasicAuth == nil {
+		return nil
+	}
+	if h.BearerToken != "" {
+		return fmt.Errorf("only one of basic_auth and bearer_token can be set")
+	}
+	h.BasicAuth.Username, err = secret(h.BasicAuth.Username, h.BasicAuth.UsernameFile, h.BasicAuth.UsernameEnv)
+	if err != nil {
+		return err
+	}
+	h.BasicAuth.Password, err = secret(h.BasicAuth.Password, h.BasicAuth.PasswordFile, h.BasicAuth.PasswordEnv)
+	return err
+}
+
+// NewClient returns an http.Client that adds the authentication and headers
+// to every request.
+func (h HTTPClient) NewClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: h.InsecureSkipVerify}
+	return &http.Client{
+		Timeout:   h.Timeout,
+		Transport: &roundTripper{next: transport, config: h},
+	}
+}
+
+// RequestHeaders returns the configured headers along with the
+// Authorization header, for clients that take headers rather than an
+// http.Client.
+func (h HTTPClient) RequestHeaders() map[string]string {
+	headers := make(map[string]string)
+	for k, v := range h.Headers {
+		headers[k] = v
+	}
+	if h.BasicAuth != nil {
+		auth := base64.StdEncoding.EncodeToString([]byte(h.BasicAuth.Username + ":" + h.BasicAuth.Password))
+		headers["Authorization"] = "Basic " + auth
+	} else if h.BearerToken != "" {
+		headers["Authorization"] = "Bearer " + h.BearerToken
+	}
+	return headers
+}
+
+type roundTripper struct {
+	next   http.RoundTripper
+	config HTTPClient
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range rt.config.RequestHeaders() {
+		req.Header.Set(k, v)
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// Send makes a request of an output. It tells whether a failed request can
+// be retried: network errors, 5xx and 429 responses can, other errors can't.
+func Send(client *http.Client, req *http.Request) (retry bool, err error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 == 2 {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	err = fmt.Errorf("unexpected status code %v: %s", res.StatusCode, bytes.TrimSpace(msg))
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+}
+
+// Backoff is the wait between the attempts of an output, it starts at a
+// second and doubles up to a minute. The zero value is ready to use.
+type Backoff struct {
+	wait time.Duration
+}
+
+// Next returns the wait before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	if b.wait == 0 {
+		b.wait = time.Second
+	} else {
+		b.wait *= 2
+	}
+	if b.wait > maxBackoff {
+		b.wait = maxBackoff
+	}
+	return b.wait
+}
+
+// Reset starts the backoff over after a success.
+func (b *Backoff) Reset() {
+	b.wait = 0
+}
+
+// Retry calls send until it succeeds, returns an error that can't be retried
+// or has been retried retries times, with a Backoff between the attempts.
+// failed is called with every error. A negative retries retries forever.
+func Retry(retries int, send func() (bool, error), failed func(error)) error {
+	var backoff Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := send()
+		if err == nil {
+			return nil
+		}
+		failed(err)
+		if !retry || (retries >= 0 && attempt >= retries) {
+			return err
+		}
+		time.Sleep(backoff.Next())
+	}
+}
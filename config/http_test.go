@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+)
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		status int
+		retry  bool
+		err    string
+	}{
+		{http.StatusNoContent, false, ""},
+		{http.StatusBadRequest, false, "unexpected status code 400: "},
+		{http.StatusTooManyRequests, true, "unexpected status code 429: "},
+		{http.StatusBadGateway, true, "unexpected status code 502: "},
+	}
+	for _, tt := range tests {
+		s, requests := configtest.NewServer(t, tt.status)
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/push", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		retry, err := Send(HTTPClient{BearerToken: "secret"}.NewClient(), req)
+		if retry != tt.retry || (err == nil) != (tt.err == "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("%v: got %v, %v, want %v, %q", tt.status, retry, err, tt.retry, tt.err)
+		}
+		if r := configtest.Next(t, requests); r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("%v: Authorization is %q", tt.status, r.Header.Get("Authorization"))
+		}
+	}
+
+	s, _ := configtest.NewServer(t)
+	s.Close()
+	req, _ := http.NewRequest(http.MethodPost, s.URL, nil)
+	if retry, err := Send(http.DefaultClient, req); !retry || err == nil {
+		t.Errorf("closed server: got %v, %v, want a retry", retry, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	var b Backoff
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute} {
+		if got := b.Next(); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	b.Reset()
+	if got := b.Next(); got != time.Second {
+		t.Errorf("got %v after a reset, want 1s", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name     string
+		retries  int
+		results  []bool
+		attempts int
+		failures int
+		err      error
+	}{
+		{"success", 2, nil, 1, 0, nil},
+		{"retried success", 2, []bool{true}, 2, 1, nil},
+		{"not retried", 2, []bool{false}, 1, 1, errFailed},
+		{"out of retries", 1, []bool{true, true}, 2, 2, errFailed},
+	}
+	for _, tt := range tests {
+		var attempts, failures int
+		err := Retry(tt.retries, func() (bool, error) {
+			attempts++
+			if attempts > len(tt.results) {
+				return false, nil
+			}
+			return tt.results[attempts-1], errFailed
+		}, func(error) { failures++ })
+		if err != tt.err || attempts != tt.attempts || failures != tt.failures {
+			t.Errorf("%v: got %v after %v attempts and %v failures, want %v after %v and %v", tt.name, err, attempts, failures, tt.err, tt.attempts, tt.failures)
+		}
+	}
+}
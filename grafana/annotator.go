@@ -0,0 +1,270 @@
+package grafana
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+// Annotator creates Grafana annotations for the profile changes, AI restarts,
+// Blue Iris starts and cameras losing signal, at the time of the log line.
+type Annotator struct {
+	url          string
+	client       *http.Client
+	dashboardUID string
+	panelID      int
+	tags         []string
+	kinds        map[string]bool
+	retries      int
+	positionFile string
+	events       chan blueiris.Event
+
+	position    position
+	hasPosition bool
+
+	annotations prometheus.Counter
+	failures    prometheus.Counter
+	dropped     prometheus.Counter
+}
+
+// position is the log time of the last annotation Grafana accepted, with the
+// lines annotated at that time. It is saved so the events of the log file are
+// not annotated again when the exporter restarts.
+type position struct {
+	Time  time.Time `json:"time"`
+	Lines []string  `json:"lines"`
+}
+
+type annotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+func NewAnnotator(c config.Grafana) (*Annotator, error) {
+	a := &Annotator{
+		url:          strings.TrimSuffix(c.URL, "/") + "/api/annotations",
+		client:       c.HTTPClient.NewClient(),
+		dashboardUID: c.DashboardUID,
+		panelID:      c.PanelID,
+		tags:         c.Tags,
+		kinds:        make(map[string]bool),
+		retries:      *c.Retries,
+		positionFile: c.PositionFile,
+		events:       make(chan blueiris.Event, 1000),
+		annotations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grafana_annotations_total",
+			Help:      "Count of annotations created in Grafana",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grafana_annotation_failures_total",
+			Help:      "Count of failed Grafana annotation requests",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grafana_dropped_annotations_total",
+			Help:      "Count of annotations dropped because the queue was full or all retries failed",
+		}),
+	}
+	for _, k := range c.Events {
+		a.kinds[k] = true
+	}
+
+	content, err := os.ReadFile(a.positionFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", a.positionFile, err)
+	}
+	err = json.Unmarshal(content, &a.position)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", a.positionFile, err)
+	}
+	a.hasPosition = true
+	return a, nil
+}
+
+// kind returns the annotation kind of the event, or "" if it isn't annotated.
+func kind(e blueiris.Event) string {
+	switch e.Type {
+	case blueiris.EventProfile:
+		return "profile"
+	case blueiris.EventAIStatus:
+		if e.Result == "started" || e.Result == "restarted" {
+			return "ai_restart"
+		}
+	case blueiris.EventServerStart:
+		return "server_start"
+	case blueiris.EventCameraState:
+		if e.State == blueiris.CameraNoSignal {
+			return "camera_signal_lost"
+		}
+	}
+	return ""
+}
+
+// Handle queues the events that are annotated, it is meant to be registered
+// with blueiris.AddEventHandler.
+func (a *Annotator) Handle(e blueiris.Event) {
+	if !a.kinds[kind(e)] {
+		return
+	}
+	select {
+	case a.events <- e:
+	default:
+		a.dropped.Inc()
+	}
+}
+
+// Run creates the annotations. Without a saved position the events from the
+// log file that was there at startup are skipped, with one only the events
+// after it are annotated.
+func (a *Annotator) Run() {
+	for e := range a.events {
+		if e.Replay && !a.hasPosition {
+			continue
+		}
+		if a.annotated(e) {
+			continue
+		}
+		if !a.send(a.annotation(e)) {
+			continue
+		}
+
+		if e.Time.After(a.position.Time) {
+			a.position = position{Time: e.Time}
+		}
+		a.position.Lines = append(a.position.Lines, e.Line)
+		a.hasPosition = true
+		err := a.save()
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Grafana - Error saving %v. Error: %v", a.positionFile, err), "console")
+		}
+	}
+}
+
+func (a *Annotator) annotated(e blueiris.Event) bool {
+	if e.Time.Before(a.position.Time) {
+		return true
+	}
+	if e.Time.Equal(a.position.Time) {
+		for _, l := range a.position.Lines {
+			if l == e.Line {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *Annotator) annotation(e blueiris.Event) annotation {
+	k := kind(e)
+	tags := append(append([]string{}, a.tags...), k)
+
+	var text string
+	switch k {
+	case "profile":
+		text = fmt.Sprintf("Profile changed to %v", e.Profile)
+		tags = append(tags, "profile:"+e.Profile)
+	case "ai_restart":
+		text = fmt.Sprintf("AI provider %v %v", e.Provider, e.Result)
+		tags = append(tags, "ai_provider:"+e.Provider)
+	case "server_start":
+		text = "Blue Iris started"
+	case "camera_signal_lost":
+		text = fmt.Sprintf("Camera %v lost signal: %v", e.Camera, e.Detail)
+		tags = append(tags, "camera:"+e.Camera)
+	}
+
+	return annotation{
+		DashboardUID: a.dashboardUID,
+		PanelID:      a.panelID,
+		Time:         e.Time.UnixMilli(),
+		Tags:         tags,
+		Text:         text,
+	}
+}
+
+// send creates the annotation, retrying with backoff after network errors,
+// 5xx and 429 responses.
+func (a *Annotator) send(an annotation) bool {
+	body, err := json.Marshal(an)
+	if err != nil {
+		a.dropped.Inc()
+		return false
+	}
+
+	err = config.Retry(a.retries, func() (bool, error) {
+		req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return config.Send(a.client, req)
+	}, func(err error) {
+		a.failures.Inc()
+		common.BIlogger(fmt.Sprintf("Grafana - Error creating annotation. Error: %v", err), "console")
+	})
+	if err != nil {
+		a.dropped.Inc()
+		return false
+	}
+	a.annotations.Inc()
+	return true
+}
+
+// save writes the position to a temporary file and renames it, so a crash
+// doesn't leave a partial file.
+func (a *Annotator) save() error {
+	b, err := json.Marshal(a.position)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(a.positionFile), filepath.Base(a.positionFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), a.positionFile)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (a *Annotator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.annotations.Desc()
+	ch <- a.failures.Desc()
+	ch <- a.dropped.Desc()
+}
+
+func (a *Annotator) Collect(ch chan<- prometheus.Metric) {
+	ch <- a.annotations
+	ch <- a.failures
+	ch <- a.dropped
+}
@@ -0,0 +1,170 @@
+package grafana
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+)
+
+func newTestAnnotator(t *testing.T, url string, positionFile string) *Annotator {
+	t.Helper()
+	retries := 2
+	a, err := NewAnnotator(config.Grafana{
+		URL:          url + "/",
+		DashboardUID: "blueiris",
+		PanelID:      4,
+		Tags:         []string{"blueiris", "nvr"},
+		Events:       []string{"profile", "ai_restart", "server_start", "camera_signal_lost"},
+		PositionFile: positionFile,
+		Retries:      &retries,
+		HTTPClient:   config.HTTPClient{BearerToken: "secret", Timeout: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func next(t *testing.T, requests chan configtest.Request) annotation {
+	t.Helper()
+	r := configtest.Next(t, requests)
+	if r.Method != http.MethodPost || r.URL.Path != "/api/annotations" || r.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("unexpected request %v %v, Authorization %q", r.Method, r.URL, r.Header.Get("Authorization"))
+	}
+	var an annotation
+	err := json.Unmarshal(r.Body, &an)
+	if err != nil {
+		t.Error(err)
+	}
+	return an
+}
+
+var at = time.Date(2026, 10, 19, 15, 0, 0, 123000000, time.UTC)
+
+func TestAnnotation(t *testing.T) {
+	grafana, annotations := configtest.NewServer(t)
+	a := newTestAnnotator(t, grafana.URL, filepath.Join(t.TempDir(), "position.json"))
+	go a.Run()
+
+	a.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Drive", Line: "trigger"})
+	a.Handle(blueiris.Event{Type: blueiris.EventProfile, Time: at, Profile: "Away", Line: "profile"})
+	a.Handle(blueiris.Event{Type: blueiris.EventCameraState, Time: at.Add(time.Second), Camera: "Drive", State: blueiris.CameraNoSignal, Detail: "network", Line: "signal"})
+
+	got := next(t, annotations)
+	want := annotation{DashboardUID: "blueiris", PanelID: 4, Time: 1792422000123, Tags: []string{"blueiris", "nvr", "profile", "profile:Away"}, Text: "Profile changed to Away"}
+	if !equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	got = next(t, annotations)
+	want = annotation{DashboardUID: "blueiris", PanelID: 4, Time: 1792422001123, Tags: []string{"blueiris", "nvr", "camera_signal_lost", "camera:Drive"}, Text: "Camera Drive lost signal: network"}
+	if !equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	configtest.None(t, annotations)
+	configtest.WaitFor(t, a.annotations, 2)
+}
+
+func equal(a, b annotation) bool {
+	if a.DashboardUID != b.DashboardUID || a.PanelID != b.PanelID || a.Time != b.Time || a.Text != b.Text || len(a.Tags) != len(b.Tags) {
+		return false
+	}
+	for i := range a.Tags {
+		if a.Tags[i] != b.Tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAnnotationRetry(t *testing.T) {
+	grafana, annotations := configtest.NewServer(t, http.StatusBadGateway, http.StatusTooManyRequests, http.StatusNoContent, http.StatusBadRequest)
+	a := newTestAnnotator(t, grafana.URL, filepath.Join(t.TempDir(), "position.json"))
+	go a.Run()
+
+	a.Handle(blueiris.Event{Type: blueiris.EventServerStart, Time: at, Line: "start"})
+	a.Handle(blueiris.Event{Type: blueiris.EventProfile, Time: at.Add(time.Second), Profile: "Home", Line: "profile"})
+
+	// The 502 and 429 are retried, the 400 isn't.
+	for _, text := range []string{"Blue Iris started", "Blue Iris started", "Blue Iris started", "Profile changed to Home"} {
+		if got := next(t, annotations); got.Text != text {
+			t.Errorf("got %q, want %q", got.Text, text)
+		}
+	}
+	configtest.None(t, annotations)
+	configtest.WaitFor(t, a.annotations, 1)
+	configtest.WaitFor(t, a.failures, 3)
+	configtest.WaitFor(t, a.dropped, 1)
+}
+
+func TestAnnotationRestart(t *testing.T) {
+	grafana, annotations := configtest.NewServer(t)
+	positionFile := filepath.Join(t.TempDir(), "position.json")
+	events := []blueiris.Event{
+		{Type: blueiris.EventProfile, Time: at, Profile: "Away", Line: "profile away"},
+		{Type: blueiris.EventAIStatus, Time: at, Provider: "CodeProject.AI", Result: "restarted", Line: "ai restarted"},
+		{Type: blueiris.EventProfile, Time: at.Add(time.Minute), Profile: "Home", Line: "profile home"},
+	}
+
+	// Without a saved position the events of the current log file are skipped.
+	a := newTestAnnotator(t, grafana.URL, positionFile)
+	done := make(chan struct{})
+	go func() {
+		a.Run()
+		close(done)
+	}()
+	a.Handle(blueiris.Event{Type: blueiris.EventServerStart, Time: at.Add(-time.Hour), Line: "old start", Replay: true})
+	a.Handle(events[0])
+	a.Handle(events[1])
+	next(t, annotations)
+	next(t, annotations)
+	configtest.None(t, annotations)
+	close(a.events)
+	<-done
+
+	// After a restart the log file is replayed, only the events after the
+	// saved position are annotated. The second line at the same time as the
+	// position was annotated too, so it isn't repeated.
+	a = newTestAnnotator(t, grafana.URL, positionFile)
+	go a.Run()
+	defer close(a.events)
+	for _, e := range events {
+		e.Replay = true
+		a.Handle(e)
+	}
+	if got := next(t, annotations); got.Text != "Profile changed to Home" {
+		t.Errorf("got %q after the restart, want the new profile", got.Text)
+	}
+	configtest.None(t, annotations)
+}
+
+func TestAnnotated(t *testing.T) {
+	a := &Annotator{position: position{Time: at, Lines: []string{"first", "second"}}}
+
+	tests := []struct {
+		name  string
+		event blueiris.Event
+		want  bool
+	}{
+		{"before the position", blueiris.Event{Time: at.Add(-time.Millisecond), Line: "other"}, true},
+		{"first line at the position", blueiris.Event{Time: at, Line: "first"}, true},
+		{"second line at the position", blueiris.Event{Time: at, Line: "second"}, true},
+		{"other line at the position", blueiris.Event{Time: at, Line: "third"}, false},
+		{"after the position", blueiris.Event{Time: at.Add(time.Millisecond), Line: "first"}, false},
+	}
+	for _, tt := range tests {
+		if got := a.annotated(tt.event); got != tt.want {
+			t.Errorf("%v: annotated is %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	empty := &Annotator{}
+	if empty.annotated(blueiris.Event{Time: at, Line: "first"}) {
+		t.Error("annotated without a position")
+	}
+}
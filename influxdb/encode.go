@@ -0,0 +1,109 @@
+package influxdb
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// encode returns the event as a line protocol point, or an empty string for
+// events that aren't written.
+func encode(e blueiris.Event) string {
+	tags := map[string]string{}
+	fields := map[string]interface{}{}
+
+	switch e.Type {
+	case blueiris.EventTrigger:
+		tags["camera"] = e.Camera
+		tags["source"] = e.Detail
+		fields["count"] = e.Count
+	case blueiris.EventAI:
+		tags["camera"] = e.Camera
+		tags["object"] = e.Object
+		tags["type"] = e.Result
+		tags["ai_provider"] = e.Provider
+		tags["model"] = e.Model
+		fields["duration_ms"] = e.Duration
+		if e.Result == "alert" {
+			fields["confidence"] = e.Confidence
+		} else {
+			fields["detail"] = e.Detail
+		}
+	case blueiris.EventCameraState:
+		tags["camera"] = e.Camera
+		tags["state"] = e.State
+		fields["detail"] = e.Detail
+	case blueiris.EventAIStatus:
+		tags["ai_provider"] = e.Provider
+		tags["event"] = e.Result
+		fields["state"] = e.State
+	case blueiris.EventPush:
+		tags["camera"] = e.Camera
+		tags["status"] = e.Result
+		fields["detail"] = e.Detail
+	case blueiris.EventProfile:
+		tags["profile"] = e.Profile
+		fields["active"] = true
+	case blueiris.EventFolder:
+		tags["folder"] = e.Folder
+		fields["disk_free_bytes"] = e.DiskFree
+		fields["folder_used_percent"] = e.FolderUsed
+		fields["hours_used_percent"] = e.HoursUsed
+	case blueiris.EventError, blueiris.EventWarning:
+		fields["message"] = e.Detail
+	case blueiris.EventWebLogin:
+		tags["user"] = e.User
+		tags["result"] = e.Result
+		fields["ip"] = e.IP
+	case blueiris.EventWebBan:
+		fields["ip"] = e.IP
+	default:
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace("blueiris_" + e.Type))
+	for _, k := range sortedKeys(tags) {
+		if tags[k] == "" {
+			continue
+		}
+		b.WriteString("," + tagEscaper.Replace(k) + "=" + tagEscaper.Replace(tags[k]))
+	}
+
+	for i, k := range sortedKeys(fields) {
+		if i == 0 {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(",")
+		}
+		b.WriteString(tagEscaper.Replace(k) + "=")
+		switch v := fields[k].(type) {
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		case string:
+			b.WriteString(`"` + stringEscaper.Replace(v) + `"`)
+		}
+	}
+
+	b.WriteString(" " + strconv.FormatInt(e.Time.UnixNano(), 10))
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
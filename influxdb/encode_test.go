@@ -0,0 +1,63 @@
+package influxdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+)
+
+func TestEncode(t *testing.T) {
+	at := time.Unix(1760886000, 123000000)
+
+	tests := []struct {
+		name  string
+		event blueiris.Event
+		want  string
+	}{
+		{
+			name:  "tag with spaces, commas and equals signs",
+			event: blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Front Door, Left=1", Detail: "MOTION", Count: 4},
+			want:  `blueiris_trigger,camera=Front\ Door\,\ Left\=1,source=MOTION count=4 1760886000123000000`,
+		},
+		{
+			name:  "quotes are literal in tags",
+			event: blueiris.Event{Type: blueiris.EventWebLogin, Time: at, User: `"admin"`, Result: "failed", IP: "10.0.0.5"},
+			want:  `blueiris_web_login,result=failed,user="admin" ip="10.0.0.5" 1760886000123000000`,
+		},
+		{
+			name:  "quotes and backslashes in string fields",
+			event: blueiris.Event{Type: blueiris.EventCameraState, Time: at, Camera: "Drive", State: "no_signal", Detail: `Signal: "network" C:\ error, retry=2`},
+			want:  `blueiris_camera_state,camera=Drive,state=no_signal detail="Signal: \"network\" C:\\ error, retry=2" 1760886000123000000`,
+		},
+		{
+			name:  "newlines",
+			event: blueiris.Event{Type: blueiris.EventError, Time: at, Detail: "first\nsecond"},
+			want:  `blueiris_error message="first\nsecond" 1760886000123000000`,
+		},
+		{
+			name:  "alerts have the confidence",
+			event: blueiris.Event{Type: blueiris.EventAI, Time: at, Camera: "Drive", Object: "person", Result: "alert", Provider: "CodeProject.AI", Model: "ipcam-combined", Detail: "87", Confidence: 87, Duration: 123},
+			want:  `blueiris_ai,ai_provider=CodeProject.AI,camera=Drive,model=ipcam-combined,object=person,type=alert confidence=87,duration_ms=123 1760886000123000000`,
+		},
+		{
+			name:  "empty tags are left out",
+			event: blueiris.Event{Type: blueiris.EventAI, Time: at, Camera: "Drive", Object: "person", Result: "canceled", Detail: "nothing found", Duration: 80.5},
+			want:  `blueiris_ai,camera=Drive,object=person,type=canceled detail="nothing found",duration_ms=80.5 1760886000123000000`,
+		},
+		{
+			name:  "events that aren't written",
+			event: blueiris.Event{Type: blueiris.EventLog, Time: at, Detail: "anything"},
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encode(tt.event)
+			if got != tt.want {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
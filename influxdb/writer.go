@@ -0,0 +1,184 @@
+package influxdb
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+// Writer writes the log events to InfluxDB v2 as points with the timestamp
+// of their log line.
+type Writer struct {
+	url           string
+	token         string
+	client        *http.Client
+	batchSize     int
+	flushInterval time.Duration
+	maxBuffer     int
+	events        chan blueiris.Event
+	full          chan struct{}
+
+	mutex  sync.Mutex
+	buffer []string
+
+	points   prometheus.Counter
+	failures prometheus.Counter
+	dropped  prometheus.Counter
+}
+
+func NewWriter(c config.InfluxDB) *Writer {
+	query := url.Values{}
+	query.Set("org", c.Org)
+	query.Set("bucket", c.Bucket)
+	query.Set("precision", "ns")
+
+	return &Writer{
+		url:           strings.TrimSuffix(c.URL, "/") + "/api/v2/write?" + query.Encode(),
+		token:         c.Token,
+		client:        c.HTTPClient.NewClient(),
+		batchSize:     c.BatchSize,
+		flushInterval: c.FlushInterval,
+		maxBuffer:     c.MaxBuffer,
+		events:        make(chan blueiris.Event, 1000),
+		full:          make(chan struct{}, 1),
+		points: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "influxdb_points_total",
+			Help:      "Count of points written to InfluxDB",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "influxdb_write_failures_total",
+			Help:      "Count of failed InfluxDB writes",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "influxdb_dropped_points_total",
+			Help:      "Count of points dropped because the buffer was full or InfluxDB rejected them",
+		}),
+	}
+}
+
+// Handle queues an event for writing, it is meant to be registered with
+// blueiris.AddEventHandler.
+func (w *Writer) Handle(e blueiris.Event) {
+	select {
+	case w.events <- e:
+	default:
+		w.dropped.Inc()
+	}
+}
+
+// Run buffers the events as points. They are written by another goroutine,
+// so a slow or unreachable InfluxDB only fills the buffer.
+func (w *Writer) Run() {
+	go w.flushLoop()
+	for e := range w.events {
+		line := encode(e)
+		if line == "" {
+			continue
+		}
+		w.mutex.Lock()
+		w.buffer = append(w.buffer, line)
+		w.trim()
+		full := len(w.buffer) >= w.batchSize
+		w.mutex.Unlock()
+		if full {
+			select {
+			case w.full <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// trim drops the oldest points once more than maxBuffer are waiting, the
+// mutex must be held.
+func (w *Writer) trim() {
+	if len(w.buffer) > w.maxBuffer {
+		w.dropped.Add(float64(len(w.buffer) - w.maxBuffer))
+		w.buffer = w.buffer[len(w.buffer)-w.maxBuffer:]
+	}
+}
+
+func (w *Writer) flushLoop() {
+	ticker := time.NewTicker(w.flushInterval)
+	for {
+		select {
+		case <-w.full:
+		case <-ticker.C:
+		}
+		w.flush()
+	}
+}
+
+// flush writes the buffer in batches. A batch that failed with an error that
+// can be retried goes back to the front of the buffer and is retried with
+// backoff, while new points keep being buffered.
+func (w *Writer) flush() {
+	var backoff config.Backoff
+	for {
+		w.mutex.Lock()
+		n := min(w.batchSize, len(w.buffer))
+		batch := w.buffer[:n:n]
+		w.buffer = w.buffer[n:]
+		w.mutex.Unlock()
+		if n == 0 {
+			return
+		}
+
+		retry, err := w.write(batch)
+		if err == nil {
+			w.points.Add(float64(n))
+			backoff.Reset()
+			continue
+		}
+		w.failures.Inc()
+		common.BIlogger(fmt.Sprintf("InfluxDB - Error writing points. Error: %v", err), "console")
+		if !retry {
+			w.dropped.Add(float64(n))
+			continue
+		}
+
+		w.mutex.Lock()
+		w.buffer = append(batch, w.buffer...)
+		w.trim()
+		w.mutex.Unlock()
+		time.Sleep(backoff.Next())
+	}
+}
+
+func (w *Writer) write(lines []string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+
+	return config.Send(w.client, req)
+}
+
+func (w *Writer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- w.points.Desc()
+	ch <- w.failures.Desc()
+	ch <- w.dropped.Desc()
+}
+
+func (w *Writer) Collect(ch chan<- prometheus.Metric) {
+	ch <- w.points
+	ch <- w.failures
+	ch <- w.dropped
+}
@@ -0,0 +1,132 @@
+package influxdb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+)
+
+func newTestWriter(url string, flushInterval time.Duration) *Writer {
+	return NewWriter(config.InfluxDB{
+		URL:           url + "/",
+		Org:           "home",
+		Bucket:        "blue iris",
+		Token:         "secret",
+		BatchSize:     2,
+		FlushInterval: flushInterval,
+		MaxBuffer:     10,
+		HTTPClient:    config.HTTPClient{Timeout: 5 * time.Second},
+	})
+}
+
+func trigger(camera string, count float64) blueiris.Event {
+	return blueiris.Event{Type: blueiris.EventTrigger, Time: time.Unix(1760886000, 0), Camera: camera, Count: count}
+}
+
+// nextWrite returns the lines of the next write.
+func nextWrite(t *testing.T, writes chan configtest.Request) []string {
+	t.Helper()
+	return strings.Split(string(configtest.Next(t, writes).Body), "\n")
+}
+
+func TestWriterBatches(t *testing.T) {
+	influx, writes := configtest.NewServer(t)
+	w := newTestWriter(influx.URL, 200*time.Millisecond)
+	go w.Run()
+
+	for i := 1; i <= 3; i++ {
+		w.Handle(trigger("Drive", float64(i)))
+	}
+
+	// The points are written in batches of batch_size.
+	first := configtest.Next(t, writes)
+	q := first.URL.Query()
+	if first.URL.Path != "/api/v2/write" || q.Get("org") != "home" || q.Get("bucket") != "blue iris" || q.Get("precision") != "ns" {
+		t.Errorf("unexpected write URL %v", first.URL)
+	}
+	if auth := first.Header.Get("Authorization"); auth != "Token secret" {
+		t.Errorf("Authorization is %q, want the token", auth)
+	}
+	want := [][]string{
+		{"blueiris_trigger,camera=Drive count=1 1760886000000000000", "blueiris_trigger,camera=Drive count=2 1760886000000000000"},
+		{"blueiris_trigger,camera=Drive count=3 1760886000000000000"},
+	}
+	for i, got := range [][]string{strings.Split(string(first.Body), "\n"), nextWrite(t, writes)} {
+		if strings.Join(got, "\n") != strings.Join(want[i], "\n") {
+			t.Errorf("write %v is %q, want %q", i, got, want[i])
+		}
+	}
+	configtest.WaitFor(t, w.points, 3)
+}
+
+func TestWriterRetry(t *testing.T) {
+	influx, writes := configtest.NewServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadRequest)
+	w := newTestWriter(influx.URL, time.Hour)
+	go w.Run()
+
+	w.Handle(trigger("Drive", 1))
+	w.Handle(trigger("Drive", 2))
+	w.Handle(trigger("Gate", 1))
+	w.Handle(trigger("Gate", 2))
+
+	// The first batch is retried after the 503 and the 429, then the 400
+	// drops it and the second batch is written.
+	for i, camera := range []string{"Drive", "Drive", "Drive", "Gate"} {
+		got := nextWrite(t, writes)
+		if len(got) != 2 || !strings.Contains(got[0], "camera="+camera) {
+			t.Errorf("write %v is %q, want the %v batch", i, got, camera)
+		}
+	}
+	configtest.WaitFor(t, w.points, 2)
+	configtest.WaitFor(t, w.failures, 3)
+	configtest.WaitFor(t, w.dropped, 2)
+}
+
+func TestWriterSlowInfluxDB(t *testing.T) {
+	writing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case writing <- struct{}{}:
+		default:
+		}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+	defer close(release)
+
+	w := newTestWriter(influx.URL, time.Hour)
+	go w.Run()
+
+	w.Handle(trigger("Drive", 0))
+	w.Handle(trigger("Drive", 1))
+	<-writing
+
+	// While the first batch hangs the events are still buffered, and the
+	// oldest points are dropped once the buffer is full.
+	for i := 2; i < 20; i++ {
+		w.Handle(trigger("Drive", float64(i)))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(w.events) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v events not buffered while InfluxDB hangs", len(w.events))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	configtest.WaitFor(t, w.dropped, 8)
+
+	w.mutex.Lock()
+	oldest := w.buffer[0]
+	w.mutex.Unlock()
+	if !strings.Contains(oldest, "count=10 ") {
+		t.Errorf("oldest buffered point is %q, want count=10", oldest)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var landingTemplate = template.Must(template.New("landing").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Blue Iris Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; vertical-align: top; }
+.error { color: #c00; }
+code { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>Blue Iris Exporter</h1>
+<table>
+<tr><th>Version</th><td>{{ .Version }} ({{ .GoVersion }})</td></tr>
+<tr><th>Log path</th><td><code>{{ .LogPath }}</code></td></tr>
+<tr><th>Log file</th><td>{{ if .Status.LogFile }}<code>{{ .Status.LogFile }}</code>{{ else }}None{{ end }}</td></tr>
+<tr><th>Position</th><td>{{ if .Status.Line }}Line {{ .Status.Line }}, written {{ .Status.LastLineTime.Format "2006-01-02 15:04:05" }}{{ else }}No lines read{{ end }}</td></tr>
+<tr><th>Last successful read</th><td>{{ if .Status.LastRead.IsZero }}Never{{ else }}{{ .Status.LastRead.Format "2006-01-02 15:04:05" }} ({{ ago .Status.LastRead }}){{ end }}</td></tr>
+{{ if .Status.LastError }}<tr><th>Read error</th><td class="error">{{ .Status.LastError }}</td></tr>
+{{ end }}<tr><th>Parse errors</th><td{{ if .Status.ParseErrors }} class="error"{{ end }}>{{ .Status.ParseErrors }} ({{ .Status.ParseErrorLines }} unique lines, see <code>blueiris_parse_errors</code>)</td></tr>
+<tr><th>Collectors</th><td>{{ range $i, $c := .Collectors }}{{ if $i }}, {{ end }}{{ $c }}{{ end }}</td></tr>
+<tr><th>Outputs</th><td>{{ range $i, $o := .Outputs }}{{ if $i }}, {{ end }}{{ $o }}{{ else }}None{{ end }}</td></tr>
+</table>
+<h2>Endpoints</h2>
+<ul>
+{{ range .Links }}<li>{{ if .URL }}<a href="{{ .URL }}">{{ .Path }}</a>{{ else }}<code>{{ .Path }}</code>{{ end }} - {{ .Description }}</li>
+{{ end }}</ul>
+</body>
+</html>
+`))
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version string
+
+type landingLink struct {
+	Path        string
+	URL         string
+	Description string
+}
+
+// landingPage shows the version, where the exporter is in the log and what
+// is enabled, so the first check after setting it up is opening the port in
+// a browser.
+type landingPage struct {
+	logpath    string
+	collectors []string
+	outputs    []string
+	links      []landingLink
+}
+
+func newLandingPage(c *config.Config, opts options, logpath string) *landingPage {
+	p := &landingPage{logpath: logpath}
+
+	p.collectors = append(p.collectors, "Blue Iris log", "Go runtime")
+	if opts.apiTarget != "" {
+		p.collectors = append(p.collectors, "Blue Iris camera API ("+opts.apiTarget+")")
+	}
+	if opts.cpaiURL != "" {
+		p.collectors = append(p.collectors, "CodeProject.AI status ("+opts.cpaiURL+")")
+	}
+	if opts.probe.url != "" {
+		p.collectors = append(p.collectors, "AI probe ("+opts.probe.url+")")
+	}
+
+	if c.MQTT != nil {
+		p.outputs = append(p.outputs, "MQTT")
+	}
+	if c.RemoteWrite != nil {
+		p.outputs = append(p.outputs, "remote_write")
+	}
+	if c.OTLP != nil {
+		p.outputs = append(p.outputs, "OTLP")
+	}
+	if c.InfluxDB != nil {
+		p.outputs = append(p.outputs, "InfluxDB")
+	}
+	if c.Loki != nil {
+		p.outputs = append(p.outputs, "Loki")
+	}
+	if len(c.Webhooks) > 0 {
+		p.outputs = append(p.outputs, "webhooks")
+	}
+	if c.StatsD != nil {
+		p.outputs = append(p.outputs, "StatsD")
+	}
+	if c.Archive != nil {
+		p.outputs = append(p.outputs, "event archive")
+	}
+	if c.Alertmanager != nil {
+		p.outputs = append(p.outputs, "Alertmanager")
+	}
+	if c.Grafana != nil {
+		p.outputs = append(p.outputs, "Grafana annotations")
+	}
+	if opts.eventStream {
+		p.outputs = append(p.outputs, "event stream")
+	}
+
+	p.links = []landingLink{
+		{opts.metricsPath, opts.metricsPath, "Metrics"},
+		{"/api/cameras", "/api/cameras", "Camera state as JSON, see the JSON API in the README for the other endpoints"},
+		{"/api/openapi.json", "/api/openapi.json", "OpenAPI document of the JSON API"},
+	}
+	if opts.eventStream {
+		p.links = append(p.links, landingLink{"/api/events/stream", "/api/events/stream", "Parsed events as Server-Sent Events"})
+	}
+	p.links = append(p.links, landingLink{"/debug/line?hash=", "", "Log line of an ai_duration_seconds exemplar, by its line_hash"})
+	if len(c.Modules) > 0 {
+		p.links = append(p.links, landingLink{"/probe?target=", "", "Metrics of a Blue Iris web server"})
+	}
+	return p
+}
+
+func (p *landingPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	v := version
+	goVersion := ""
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" {
+			v = info.Main.Version
+		}
+		goVersion = info.GoVersion
+	}
+	if v == "" {
+		v = "unknown"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := landingTemplate.Execute(w, map[string]interface{}{
+		"Version":    v,
+		"GoVersion":  goVersion,
+		"LogPath":    p.logpath,
+		"Status":     blueiris.Status(p.logpath),
+		"Collectors": p.collectors,
+		"Outputs":    p.outputs,
+		"Links":      p.links,
+	})
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("Error rendering the landing page. Error: %v", err), "console")
+	}
+}
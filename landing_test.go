@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func TestLandingProbeLink(t *testing.T) {
+	hasProbe := func(p *landingPage) bool {
+		for _, l := range p.links {
+			if l.Path == "/probe?target=" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if hasProbe(newLandingPage(&config.Config{}, options{metricsPath: "/metrics"}, "")) {
+		t.Error("/probe linked without modules")
+	}
+	c := &config.Config{Modules: map[string]config.Module{"default": {}}}
+	if !hasProbe(newLandingPage(c, options{metricsPath: "/metrics"}, "")) {
+		t.Error("/probe not linked with modules")
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"errors"
 )
 
-func IsService(name string) error {
-	return nil
+func IsService(name string, opts options) (bool, error) {
+	return false, nil
 }
 
 func removeService(name string) error {
@@ -26,7 +26,7 @@ func controlService(name string, command string) error {
 	return err
 }
 
-func installService(name, desc string, logpath string, metricsPath string, port string) error {
+func installService(name, desc string, args []string) error {
 	err := errors.New("--service.install is not supprted in Linux!")
 	return err
 }
@@ -0,0 +1,284 @@
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+// Pusher pushes every log line to the Loki push API, with the fields the
+// parser extracted from it as structured metadata. Only the level and the AI
+// alert type are stream labels, so the number of streams stays bounded.
+type Pusher struct {
+	url           string
+	client        *http.Client
+	labels        map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	maxBuffer     int
+	includeReplay bool
+	events        chan blueiris.Event
+
+	pending []blueiris.Event
+	buffer  []entry
+	backoff config.Backoff
+	retryAt time.Time
+
+	entries  prometheus.Counter
+	failures prometheus.Counter
+	dropped  prometheus.Counter
+}
+
+type entry struct {
+	stream   map[string]string
+	time     time.Time
+	line     string
+	metadata map[string]string
+}
+
+func NewPusher(c config.Loki) *Pusher {
+	return &Pusher{
+		url:           c.URL,
+		client:        c.HTTPClient.NewClient(),
+		labels:        c.Labels,
+		batchSize:     c.BatchSize,
+		flushInterval: c.FlushInterval,
+		maxBuffer:     c.MaxBuffer,
+		includeReplay: c.IncludeReplay,
+		events:        make(chan blueiris.Event, 1000),
+		entries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "loki_entries_total",
+			Help:      "Count of log lines pushed to Loki",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "loki_push_failures_total",
+			Help:      "Count of failed Loki pushes",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "loki_dropped_entries_total",
+			Help:      "Count of log lines dropped because the buffer was full or Loki rejected them",
+		}),
+	}
+}
+
+// Handle queues an event for pushing, it is meant to be registered with
+// blueiris.AddEventHandler.
+func (p *Pusher) Handle(e blueiris.Event) {
+	if e.Replay && !p.includeReplay {
+		return
+	}
+	select {
+	case p.events <- e:
+	default:
+		if e.Type == blueiris.EventLog {
+			p.dropped.Inc()
+		}
+	}
+}
+
+func (p *Pusher) Run() {
+	ticker := time.NewTicker(p.flushInterval)
+	for {
+		select {
+		case e := <-p.events:
+			if e.Type != blueiris.EventLog {
+				p.pending = append(p.pending, e)
+				continue
+			}
+			p.buffer = append(p.buffer, p.newEntry(e))
+			p.pending = nil
+			if len(p.buffer) > p.maxBuffer {
+				p.dropped.Add(float64(len(p.buffer) - p.maxBuffer))
+				p.buffer = p.buffer[len(p.buffer)-p.maxBuffer:]
+			}
+			if len(p.buffer) >= p.batchSize {
+				p.flush()
+			}
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+// newEntry builds the entry for a log line from the events parsed from it.
+func (p *Pusher) newEntry(l blueiris.Event) entry {
+	e := entry{
+		stream:   make(map[string]string),
+		time:     l.Time,
+		line:     l.Message,
+		metadata: make(map[string]string),
+	}
+	for k, v := range p.labels {
+		e.stream[k] = v
+	}
+	e.stream["level"] = l.Level
+	e.metadata["object"] = l.Source
+
+	for _, ev := range p.pending {
+		if ev.Line != l.Line {
+			continue
+		}
+		e.metadata["event"] = ev.Type
+		switch ev.Type {
+		case blueiris.EventAI:
+			e.stream["alert_type"] = ev.Result
+			e.metadata["ai_object"] = ev.Object
+			if ev.Result == "canceled" {
+				e.metadata["ai_object"] = "canceled"
+			}
+			e.metadata["ai_detail"] = ev.Detail
+			e.metadata["duration"] = formatFloat(ev.Duration)
+			e.metadata["ai_provider"] = ev.Provider
+			e.metadata["model"] = ev.Model
+		case blueiris.EventTrigger:
+			e.metadata["trigger_source"] = ev.Detail
+		case blueiris.EventCameraState:
+			e.metadata["camera_state"] = ev.State
+		case blueiris.EventAIStatus:
+			e.metadata["ai_provider"] = ev.Provider
+			e.metadata["ai_event"] = ev.Result
+			e.metadata["ai_state"] = ev.State
+		case blueiris.EventPush:
+			e.metadata["push_status"] = ev.Result
+		case blueiris.EventProfile:
+			e.metadata["profile"] = ev.Profile
+		case blueiris.EventFolder:
+			e.metadata["disk_pct"] = strconv.FormatFloat(ev.FolderUsed, 'f', 2, 64)
+			e.metadata["disk_free"] = formatFloat(ev.DiskFree / 1000 / 1000)
+			if ev.HoursUsed > 0 {
+				e.metadata["hours_pct"] = strconv.FormatFloat(ev.HoursUsed, 'f', 2, 64)
+			}
+		case blueiris.EventWebLogin:
+			e.metadata["user"] = ev.User
+			e.metadata["result"] = ev.Result
+			e.metadata["ip"] = ev.IP
+		case blueiris.EventWebBan:
+			e.metadata["ip"] = ev.IP
+		}
+	}
+
+	for k, v := range e.stream {
+		if v == "" {
+			delete(e.stream, k)
+		}
+	}
+	for k, v := range e.metadata {
+		if v == "" {
+			delete(e.metadata, k)
+		}
+	}
+	return e
+}
+
+// flush pushes the buffer in batches. After a failure that can be retried the
+// rest of the buffer is kept and pushing backs off.
+func (p *Pusher) flush() {
+	if time.Now().Before(p.retryAt) {
+		return
+	}
+	for len(p.buffer) > 0 {
+		n := p.batchSize
+		if n > len(p.buffer) {
+			n = len(p.buffer)
+		}
+
+		retry, err := p.push(p.buffer[:n])
+		if err != nil {
+			p.failures.Inc()
+			common.BIlogger(fmt.Sprintf("Loki - Error pushing log lines. Error: %v", err), "console")
+			if retry {
+				p.retryAt = time.Now().Add(p.backoff.Next())
+				return
+			}
+			p.dropped.Add(float64(n))
+		} else {
+			p.entries.Add(float64(n))
+		}
+		p.backoff.Reset()
+		p.buffer = p.buffer[n:]
+	}
+	p.buffer = nil
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]interface{}   `json:"values"`
+}
+
+func (p *Pusher) push(entries []entry) (bool, error) {
+	streams := make(map[string]*stream)
+	var keys []string
+	for _, e := range entries {
+		key := streamKey(e.stream)
+		s, ok := streams[key]
+		if !ok {
+			s = &stream{Stream: e.stream}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+		value := []interface{}{strconv.FormatInt(e.time.UnixNano(), 10), e.line}
+		if len(e.metadata) > 0 {
+			value = append(value, e.metadata)
+		}
+		s.Values = append(s.Values, value)
+	}
+
+	var body struct {
+		Streams []*stream `json:"streams"`
+	}
+	for _, k := range keys {
+		body.Streams = append(body.Streams, streams[k])
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return config.Send(p.client, req)
+}
+
+func streamKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (p *Pusher) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.entries.Desc()
+	ch <- p.failures.Desc()
+	ch <- p.dropped.Desc()
+}
+
+func (p *Pusher) Collect(ch chan<- prometheus.Metric) {
+	ch <- p.entries
+	ch <- p.failures
+	ch <- p.dropped
+}
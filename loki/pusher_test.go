@@ -0,0 +1,163 @@
+package loki
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+)
+
+type value struct {
+	time     string
+	line     string
+	metadata map[string]string
+}
+
+// next returns the values of the next push by the key of their stream.
+func next(t *testing.T, requests chan configtest.Request) map[string][]value {
+	t.Helper()
+	r := configtest.Next(t, requests)
+	if r.Method != http.MethodPost || r.URL.Path != "/loki/api/v1/push" || r.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("unexpected request %v %v, Authorization %q", r.Method, r.URL, r.Header.Get("Authorization"))
+	}
+
+	var body struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+	err := json.Unmarshal(r.Body, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := make(map[string][]value)
+	for _, s := range body.Streams {
+		for _, raw := range s.Values {
+			var v value
+			err := json.Unmarshal(raw[0], &v.time)
+			if err == nil {
+				err = json.Unmarshal(raw[1], &v.line)
+			}
+			if err == nil && len(raw) > 2 {
+				err = json.Unmarshal(raw[2], &v.metadata)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			streams[streamKey(s.Stream)] = append(streams[streamKey(s.Stream)], v)
+		}
+	}
+	return streams
+}
+
+func newTestPusher(url string, flushInterval time.Duration, includeReplay bool) *Pusher {
+	return NewPusher(config.Loki{
+		URL:           url + "/loki/api/v1/push",
+		Labels:        map[string]string{"job": "blue_iris"},
+		BatchSize:     2,
+		FlushInterval: flushInterval,
+		MaxBuffer:     10,
+		IncludeReplay: includeReplay,
+		HTTPClient:    config.HTTPClient{BearerToken: "secret", Timeout: 5 * time.Second},
+	})
+}
+
+var at = time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+
+func logLine(line, level, source, message string) blueiris.Event {
+	return blueiris.Event{Type: blueiris.EventLog, Time: at, Level: level, Source: source, Message: message, Line: line}
+}
+
+func TestPusher(t *testing.T) {
+	loki, requests := configtest.NewServer(t)
+	p := newTestPusher(loki.URL, time.Hour, false)
+	go p.Run()
+
+	p.Handle(blueiris.Event{Type: blueiris.EventAI, Time: at, Camera: "Drive", Object: "person", Result: "alert", Detail: "person:87%", Confidence: 87, Duration: 123, Provider: "CodeProject.AI", Line: "ai"})
+	p.Handle(logLine("ai", "info", "Drive", "AI: Alert person:87% [Object Detection] 123ms"))
+	p.Handle(blueiris.Event{Type: blueiris.EventCameraState, Time: at, Camera: "Gate", State: blueiris.CameraNoSignal, Line: "signal"})
+	p.Handle(logLine("signal", "warning", "Gate", "Signal: network retry"))
+
+	// The camera and the AI object are metadata, only the level and the
+	// alert type make a stream.
+	got := next(t, requests)
+	want := map[string][]value{
+		`alert_type="alert",job="blue_iris",level="info"`: {{
+			time: "1792422000000000000",
+			line: "AI: Alert person:87% [Object Detection] 123ms",
+			metadata: map[string]string{
+				"object":      "Drive",
+				"event":       "ai",
+				"ai_object":   "person",
+				"ai_detail":   "person:87%",
+				"duration":    "123",
+				"ai_provider": "CodeProject.AI",
+			},
+		}},
+		`job="blue_iris",level="warning"`: {{
+			time:     "1792422000000000000",
+			line:     "Signal: network retry",
+			metadata: map[string]string{"object": "Gate", "event": "camera_state", "camera_state": blueiris.CameraNoSignal},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// A single line waits for the batch to fill up.
+	p.Handle(logLine("first", "info", "Drive", "MOTION"))
+	configtest.None(t, requests)
+	p.Handle(logLine("second", "info", "Gate", "MOTION"))
+	got = next(t, requests)
+	if len(got) != 1 || len(got[`job="blue_iris",level="info"`]) != 2 {
+		t.Errorf("got %+v, want both lines in one stream", got)
+	}
+	configtest.WaitFor(t, p.entries, 4)
+}
+
+func TestPusherReplay(t *testing.T) {
+	loki, requests := configtest.NewServer(t)
+	p := newTestPusher(loki.URL, 100*time.Millisecond, false)
+	go p.Run()
+
+	replayed := logLine("old", "info", "Drive", "MOTION")
+	replayed.Replay = true
+	p.Handle(replayed)
+	p.Handle(logLine("new", "info", "Gate", "MOTION"))
+	got := next(t, requests)
+	if v := got[`job="blue_iris",level="info"`]; len(v) != 1 || v[0].metadata["object"] != "Gate" {
+		t.Errorf("got %+v, want only the new line", got)
+	}
+
+	p = newTestPusher(loki.URL, 100*time.Millisecond, true)
+	go p.Run()
+	p.Handle(replayed)
+	got = next(t, requests)
+	if v := got[`job="blue_iris",level="info"`]; len(v) != 1 || v[0].metadata["object"] != "Drive" {
+		t.Errorf("got %+v with include_replay, want the replayed line", got)
+	}
+}
+
+func TestPusherRetry(t *testing.T) {
+	loki, requests := configtest.NewServer(t, http.StatusServiceUnavailable, http.StatusBadRequest)
+	p := newTestPusher(loki.URL, 100*time.Millisecond, false)
+	go p.Run()
+
+	// The 503 is retried after the backoff, the 400 drops the batch.
+	p.Handle(logLine("first", "info", "Drive", "MOTION"))
+	for i := 0; i < 2; i++ {
+		next(t, requests)
+	}
+	configtest.WaitFor(t, p.failures, 2)
+	configtest.WaitFor(t, p.dropped, 1)
+
+	p.Handle(logLine("second", "info", "Drive", "MOTION"))
+	next(t, requests)
+	configtest.WaitFor(t, p.entries, 1)
+}
@@ -15,22 +15,23 @@ type CollectBool map[bool][]int
 type ExporterBlueIris struct {
 	blueIrisServerMetrics map[int]common.MetricInfo
 	logpath               string
+	skipOneShot           bool
 }
 
 var (
 	namespace string = "blueiris"
 
 	blueIrisServerMetrics = metrics{
-		1:  newMetric("ai_duration", "Duration of Blue Iris AI analysis", prometheus.GaugeValue, []string{"camera", "type", "object", "detail"}, blueiris.BlueIris, CollectBool{true: []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}}, "blueIrisServerMetrics"),
-		2:  newMetric("ai_count", "Count of Blue Iris AI analysis", prometheus.GaugeValue, []string{"camera", "type"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		3:  newMetric("ai_duration_distinct", "Duration of Blue Iris AI analysis once", prometheus.GaugeValue, []string{"camera", "type", "object", "detail"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		4:  newMetric("ai_restarted", "Times BlueIris restarted Deepstack", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		5:  newMetric("ai_timeout", "Count of AI timeouts in current logfile", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		6:  newMetric("ai_servererror", "Count of AI server not responding errors in current logfile", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		7:  newMetric("ai_notresponding", "Count of AI not responding errors in current logfile", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		1:  newMetric("ai_duration", "Duration of Blue Iris AI analysis", prometheus.GaugeValue, []string{"camera", "type", "object", "detail", "ai_provider", "model"}, blueiris.BlueIris, CollectBool{true: []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}}, "blueIrisServerMetrics"),
+		2:  newMetric("ai_count", "Count of Blue Iris AI analysis", prometheus.GaugeValue, []string{"camera", "type", "ai_provider", "model"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		3:  newMetric("ai_duration_distinct", "Duration of Blue Iris AI analysis once", prometheus.GaugeValue, []string{"camera", "type", "object", "detail", "ai_provider", "model"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		4:  newMetric("ai_restarted", "Times BlueIris restarted the AI", prometheus.GaugeValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		5:  newMetric("ai_timeout", "Count of AI timeouts in current logfile", prometheus.GaugeValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		6:  newMetric("ai_servererror", "Count of AI server not responding errors in current logfile", prometheus.GaugeValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		7:  newMetric("ai_notresponding", "Count of AI not responding errors in current logfile", prometheus.GaugeValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		8:  newMetric("logerror", "Count of unique errors in the logs", prometheus.GaugeValue, []string{"error"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		9:  newMetric("logerror_total", "Count all errors in the logs", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		10: newMetric("camera_status", "Status of each camera. 0=up, 1=down", prometheus.GaugeValue, []string{"camera", "detail"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		10: newMetric("camera_status", "Status of each camera. 0=up, 1=no signal, disabled or unknown", prometheus.GaugeValue, []string{"camera", "detail"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		11: newMetric("triggers", "Count of triggers", prometheus.GaugeValue, []string{"camera"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		12: newMetric("push_notifications", "Count of push notifications sent", prometheus.GaugeValue, []string{"camera", "status", "detail"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		13: newMetric("logwarning", "Count of unique warnings in the logs", prometheus.GaugeValue, []string{"warning"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
@@ -40,10 +41,19 @@ var (
 		17: newMetric("hours_used", "Percentage of folder hours used based on limit", prometheus.GaugeValue, []string{"folder"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		18: newMetric("parse_errors", "Count of unique errors parsing log lines", prometheus.GaugeValue, []string{"line"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		19: newMetric("parse_errors_total", "Count of all the errors parsing log lines", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		20: newMetric("ai_starting", "Count of AI is being started log lines", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		21: newMetric("ai_started", "Count of AI has been started log lines", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		20: newMetric("ai_starting", "Count of AI is being started log lines", prometheus.GaugeValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		21: newMetric("ai_started", "Count of AI has been started log lines", prometheus.GaugeValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 		22: newMetric("profile", "Count of activation of profiles", prometheus.GaugeValue, []string{"profile"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
-		23: newMetric("ai_error", "Count of AI error log lines", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		23: newMetric("ai_error", "Count of AI error log lines", prometheus.GaugeValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		24: newMetric("camera_state", "State of each camera. 1 for the current state", prometheus.GaugeValue, []string{"camera", "state"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		25: newMetric("web_logins_total", "Count of web server and UI3 logins", prometheus.CounterValue, []string{"user", "result", "ip"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		26: newMetric("web_bans_total", "Count of IP addresses banned by the web server", prometheus.CounterValue, []string{"ip"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		27: newMetric("web_last_failed_login_timestamp_seconds", "Unix time of the last failed web server login", prometheus.GaugeValue, []string{}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		28: newMetric("ai_module_duration", "Duration of the last CodeProject.AI analysis per module", prometheus.GaugeValue, []string{"ai_provider", "module"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		29: newMetric("ai_state", "State of the AI service. 1 for the current state", prometheus.GaugeValue, []string{"ai_provider", "state"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		30: newMetric("ai_downtime_seconds_total", "Time the AI service was not running in seconds", prometheus.CounterValue, []string{"ai_provider"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		31: newMetric("ai_events_total", "Count of AI service events", prometheus.CounterValue, []string{"ai_provider", "event"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
+		32: newHistogram("ai_duration_seconds", "Histogram of Blue Iris AI analysis durations", []string{"camera", "type", "ai_provider", "model"}, blueiris.BlueIris, CollectBool{false: nil}, "blueIrisServerMetrics"),
 	}
 
 	scrapeDurationDesc = prometheus.NewDesc(
@@ -92,6 +102,35 @@ func newMetric(
 	}
 }
 
+// newHistogram is a metric collected as a histogram, which has no
+// prometheus.ValueType.
+func newHistogram(
+	metricName string,
+	docString string,
+	labels []string,
+	f func(ch chan<- prometheus.Metric, m common.MetricInfo, SecMet []common.MetricInfo, logpath string),
+	collect CollectBool,
+	ServerMetrics string) common.MetricInfo {
+
+	m := newMetric(metricName, docString, 0, labels, f, collect, ServerMetrics)
+	m.Histogram = true
+	return m
+}
+
+// oneShot are the metrics that only return a sample the first time it is
+// collected.
+var oneShot = map[string]bool{"ai_duration_distinct": true}
+
+func withoutOneShot(secondary []int) []int {
+	var keep []int
+	for _, i := range secondary {
+		if !oneShot[blueIrisServerMetrics[i].Name] {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
+
 func CollectMetrics(
 	wg *sync.WaitGroup,
 	ch chan<- prometheus.Metric,
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func count(t *testing.T, g prometheus.Gatherer, name string) int {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return len(mf.GetMetric())
+		}
+	}
+	return 0
+}
+
+func TestOutputsSkipOneShot(t *testing.T) {
+	dir := t.TempDir() + string(filepath.Separator)
+	log := dir + "20261019_0.txt"
+	err := os.WriteFile(log, []byte("Blue Iris log\r\n0 \t10/19/2026 2:59:59.000 PM\tApp           Current profile: 1\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, _ := NewExporterBlueIris(blueIrisServerMetrics, dir)
+	metricsReg := prometheus.NewRegistry()
+	metricsReg.MustRegister(metrics)
+	output, _ := NewExporterBlueIris(blueIrisServerMetrics, dir)
+	output.skipOneShot = true
+	outputReg := prometheus.NewRegistry()
+	outputReg.MustRegister(output)
+
+	// The first read only finds the end of the log, like at startup.
+	metricsReg.Gather()
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("0 \t10/19/2026 3:00:00.123 PM\tFrontDoor     AI: [Objects] person:87% [12,40 180,320] 123ms\r\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An output gathering first must leave the sample to /metrics.
+	if n := count(t, outputReg, "blueiris_ai_duration_distinct"); n != 0 {
+		t.Errorf("output gathered %v ai_duration_distinct samples, want none", n)
+	}
+	if n := count(t, outputReg, "blueiris_ai_duration"); n != 1 {
+		t.Errorf("output gathered %v ai_duration samples, want 1", n)
+	}
+	if n := count(t, metricsReg, "blueiris_ai_duration_distinct"); n != 1 {
+		t.Errorf("/metrics gathered %v ai_duration_distinct samples, want 1", n)
+	}
+	if n := count(t, metricsReg, "blueiris_ai_duration_distinct"); n != 0 {
+		t.Errorf("/metrics gathered the same ai_duration_distinct sample again")
+	}
+}
+
+var exemplarRegex = regexp.MustCompile(`(?m)^blueiris_ai_duration_seconds_bucket\{(.*)\} 1 # \{(.*)\} (\S+) (\S+)$`)
+
+func TestAIDurationExemplar(t *testing.T) {
+	dir := t.TempDir() + string(filepath.Separator)
+	log := dir + "20261020_0.txt"
+	err := os.WriteFile(log, []byte("Blue Iris log\r\n0 \t10/20/2026 2:59:59.000 PM\tApp           Current profile: 1\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter, _ := NewExporterBlueIris(blueIrisServerMetrics, dir)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	reg.Gather()
+
+	line := "0 \t10/20/2026 3:00:00.123 PM\tGarage        AI: [Objects] person:87% [12,40 180,320] 123ms"
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(line + "\r\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(w, req)
+	body, _ := io.ReadAll(w.Body)
+
+	// The observation is in the 0.25 bucket, with the camera and the hash of
+	// its line as the exemplar, at the time of the line.
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	hash := fmt.Sprintf("%016x", h.Sum64())
+	var found bool
+	for _, m := range exemplarRegex.FindAllStringSubmatch(string(body), -1) {
+		if !strings.Contains(m[1], `camera="Garage"`) || !strings.Contains(m[1], `le="0.25"`) {
+			continue
+		}
+		found = true
+		if want := `camera="Garage",line_hash="` + hash + `"`; m[2] != want {
+			t.Errorf("exemplar labels are {%v}, want {%v}", m[2], want)
+		}
+		if m[3] != "0.123" {
+			t.Errorf("exemplar value is %v, want 0.123", m[3])
+		}
+		ts, err := strconv.ParseFloat(m[4], 64)
+		want := time.Date(2026, 10, 20, 15, 0, 0, 123000000, time.Local)
+		if err != nil || !time.UnixMilli(int64(ts*1000+0.5)).Equal(want) {
+			t.Errorf("exemplar timestamp is %v, want %v", m[4], want)
+		}
+	}
+	if !found {
+		t.Errorf("no exemplar for Garage in\n%s", body)
+	}
+}
@@ -0,0 +1,266 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var topicRegex = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Publisher publishes the camera and folder state from the log events as
+// retained MQTT topics, along with the Home Assistant discovery configs for
+// them.
+type Publisher struct {
+	client          paho.Client
+	prefix          string
+	discoveryPrefix string
+	discovery       bool
+	node            string
+	qos             byte
+	events          chan blueiris.Event
+
+	// retained holds the last payload of every topic, it is published again
+	// after reconnecting in case the broker lost it.
+	mutex      sync.Mutex
+	retained   map[string][]byte
+	discovered map[string]bool
+}
+
+func NewPublisher(c config.MQTT) *Publisher {
+	p := &Publisher{
+		prefix:          c.TopicPrefix,
+		discoveryPrefix: c.DiscoveryPrefix,
+		discovery:       !c.DisableDiscovery,
+		node:            topicName(c.ClientID),
+		qos:             c.QoS,
+		events:          make(chan blueiris.Event, 1000),
+		retained:        make(map[string][]byte),
+		discovered:      make(map[string]bool),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(c.Broker).
+		SetClientID(c.ClientID).
+		SetUsername(c.Username).
+		SetPassword(c.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetWill(p.statusTopic(), "offline", p.qos, true).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			common.BIlogger(fmt.Sprintf("MQTT - Connection to broker lost. Error: %v", err), "console")
+		})
+	p.client = paho.NewClient(opts)
+	return p
+}
+
+// Start connects to the broker in the background and publishes the events
+// passed to Handle. Connecting is retried until the broker is reachable.
+func (p *Publisher) Start() {
+	p.client.Connect()
+	go p.run()
+}
+
+// Handle queues an event for publishing, it is meant to be registered with
+// blueiris.AddEventHandler.
+func (p *Publisher) Handle(e blueiris.Event) {
+	select {
+	case p.events <- e:
+	default:
+		common.BIlogger("MQTT - Event queue is full, dropping event", "console")
+	}
+}
+
+func (p *Publisher) run() {
+	p.discoverServer()
+	for e := range p.events {
+		switch e.Type {
+		case blueiris.EventCameraState:
+			p.discoverCamera(e.Camera)
+			p.publish(p.cameraTopic(e.Camera, "state"), []byte(e.State))
+		case blueiris.EventTrigger:
+			p.discoverCamera(e.Camera)
+			p.publish(p.cameraTopic(e.Camera, "triggers"), []byte(strconv.FormatFloat(e.Count, 'f', -1, 64)))
+		case blueiris.EventAI:
+			if e.Result != "alert" {
+				continue
+			}
+			p.discoverCamera(e.Camera)
+			attributes, _ := json.Marshal(map[string]interface{}{
+				"confidence":  e.Confidence,
+				"duration_ms": e.Duration,
+				"model":       e.Model,
+				"ai_provider": e.Provider,
+				"time":        e.Time,
+			})
+			p.publish(p.cameraTopic(e.Camera, "last_object"), []byte(e.Object))
+			p.publish(p.cameraTopic(e.Camera, "last_object/attributes"), attributes)
+		case blueiris.EventFolder:
+			p.discoverFolder(e.Folder)
+			p.publish(p.folderTopic(e.Folder, "disk_free"), []byte(strconv.FormatFloat(e.DiskFree, 'f', 0, 64)))
+			p.publish(p.folderTopic(e.Folder, "used"), []byte(strconv.FormatFloat(e.FolderUsed, 'f', 2, 64)))
+			p.publish(p.folderTopic(e.Folder, "hours_used"), []byte(strconv.FormatFloat(e.HoursUsed, 'f', 2, 64)))
+		}
+	}
+}
+
+// publish sends a retained message unless the topic already has the same
+// payload.
+func (p *Publisher) publish(topic string, payload []byte) {
+	p.mutex.Lock()
+	if old, ok := p.retained[topic]; ok && bytes.Equal(old, payload) {
+		p.mutex.Unlock()
+		return
+	}
+	p.retained[topic] = payload
+	p.mutex.Unlock()
+
+	if p.client.IsConnectionOpen() {
+		p.client.Publish(topic, p.qos, true, payload)
+	}
+}
+
+func (p *Publisher) onConnect(c paho.Client) {
+	common.BIlogger("MQTT - Connected to broker", "info")
+	c.Publish(p.statusTopic(), p.qos, true, "online")
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for topic, payload := range p.retained {
+		c.Publish(topic, p.qos, true, payload)
+	}
+}
+
+func (p *Publisher) statusTopic() string {
+	return p.prefix + "/status"
+}
+
+func (p *Publisher) cameraTopic(camera string, name string) string {
+	return p.prefix + "/camera/" + topicName(camera) + "/" + name
+}
+
+func (p *Publisher) folderTopic(folder string, name string) string {
+	return p.prefix + "/folder/" + topicName(folder) + "/" + name
+}
+
+type sensor struct {
+	component  string
+	payloadOn  string
+	payloadOff string
+
+	id       string
+	name     string
+	topic    string
+	unit     string
+	class    string
+	stateCls string
+	attrs    string
+}
+
+func (p *Publisher) serverDevice() map[string]interface{} {
+	return map[string]interface{}{
+		"identifiers":  []string{p.node},
+		"name":         "Blue Iris",
+		"manufacturer": "Blue Iris",
+		"model":        "Server",
+	}
+}
+
+// discoverServer adds the server device with a connectivity sensor for the
+// exporter, before any camera refers to it with via_device.
+func (p *Publisher) discoverServer() {
+	if !p.discovery {
+		return
+	}
+	p.discover(p.serverDevice(), sensor{component: "binary_sensor", id: "status", name: "Exporter", topic: p.statusTopic(), class: "connectivity", payloadOn: "online", payloadOff: "offline"})
+}
+
+func (p *Publisher) discoverCamera(camera string) {
+	if !p.discovery || p.discovered["camera|"+camera] {
+		return
+	}
+	p.discovered["camera|"+camera] = true
+
+	device := map[string]interface{}{
+		"identifiers":  []string{p.node + "_camera_" + topicName(camera)},
+		"name":         "Blue Iris " + camera,
+		"manufacturer": "Blue Iris",
+		"model":        "Camera",
+		"via_device":   p.node,
+	}
+	id := "camera_" + topicName(camera)
+	p.discover(device, sensor{id: id + "_state", name: "State", topic: p.cameraTopic(camera, "state")})
+	p.discover(device, sensor{id: id + "_triggers", name: "Triggers", topic: p.cameraTopic(camera, "triggers"), stateCls: "total_increasing"})
+	p.discover(device, sensor{id: id + "_last_object", name: "Last object", topic: p.cameraTopic(camera, "last_object"), attrs: p.cameraTopic(camera, "last_object/attributes")})
+}
+
+func (p *Publisher) discoverFolder(folder string) {
+	if !p.discovery || p.discovered["folder|"+folder] {
+		return
+	}
+	p.discovered["folder|"+folder] = true
+
+	device := p.serverDevice()
+	id := "folder_" + topicName(folder)
+	p.discover(device, sensor{id: id + "_disk_free", name: folder + " disk free", topic: p.folderTopic(folder, "disk_free"), unit: "B", class: "data_size", stateCls: "measurement"})
+	p.discover(device, sensor{id: id + "_used", name: folder + " used", topic: p.folderTopic(folder, "used"), unit: "%", stateCls: "measurement"})
+	p.discover(device, sensor{id: id + "_hours_used", name: folder + " hours used", topic: p.folderTopic(folder, "hours_used"), unit: "%", stateCls: "measurement"})
+}
+
+func (p *Publisher) discover(device map[string]interface{}, s sensor) {
+	c := map[string]interface{}{
+		"name":        s.name,
+		"unique_id":   p.node + "_" + s.id,
+		"object_id":   p.node + "_" + s.id,
+		"state_topic": s.topic,
+		"device":      device,
+	}
+	// The status sensor must stay available to show the exporter is offline.
+	if s.topic != p.statusTopic() {
+		c["availability_topic"] = p.statusTopic()
+	}
+	if s.payloadOn != "" {
+		c["payload_on"] = s.payloadOn
+		c["payload_off"] = s.payloadOff
+	}
+	if s.unit != "" {
+		c["unit_of_measurement"] = s.unit
+	}
+	if s.class != "" {
+		c["device_class"] = s.class
+	}
+	if s.stateCls != "" {
+		c["state_class"] = s.stateCls
+	}
+	if s.attrs != "" {
+		c["json_attributes_topic"] = s.attrs
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("MQTT - Error encoding discovery config. Error: %v", err), "console")
+		return
+	}
+	component := s.component
+	if component == "" {
+		component = "sensor"
+	}
+	p.publish(p.discoveryPrefix+"/"+component+"/"+p.node+"/"+s.id+"/config", payload)
+}
+
+// topicName makes a camera or folder name safe to use as a topic level and
+// Home Assistant id.
+func topicName(name string) string {
+	return topicRegex.ReplaceAllString(name, "_")
+}
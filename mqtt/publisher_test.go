@@ -0,0 +1,152 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func startBroker(t *testing.T, addr string) *server.Server {
+	t.Helper()
+	s := server.New(&server.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	err := s.AddHook(new(auth.AllowHook), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	return s
+}
+
+// waitRetained waits until the broker has a retained message for every topic
+// and returns all of them.
+func waitRetained(t *testing.T, s *server.Server, topics ...string) map[string]string {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		retained := make(map[string]string)
+		for _, pk := range s.Topics.Messages("#") {
+			if pk.FixedHeader.Retain {
+				retained[pk.TopicName] = string(pk.Payload)
+			}
+		}
+		missing := ""
+		for _, topic := range topics {
+			if _, ok := retained[topic]; !ok {
+				missing = topic
+			}
+		}
+		if missing == "" {
+			return retained
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no retained message for %v, have %v", missing, retained)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	broker := startBroker(t, addr)
+	p := NewPublisher(config.MQTT{
+		Broker:          "tcp://" + addr,
+		ClientID:        "bie_test",
+		TopicPrefix:     "blueiris",
+		DiscoveryPrefix: "homeassistant",
+		QoS:             1,
+	})
+	p.Start()
+	defer p.client.Disconnect(0)
+
+	p.Handle(blueiris.Event{Type: blueiris.EventCameraState, Camera: "Front Door", State: blueiris.CameraNoSignal})
+	p.Handle(blueiris.Event{Type: blueiris.EventTrigger, Camera: "Front Door", Count: 3})
+	p.Handle(blueiris.Event{Type: blueiris.EventAI, Camera: "Front Door", Object: "person", Result: "alert", Detail: "87", Confidence: 87, Duration: 123})
+
+	serverTopic := "homeassistant/binary_sensor/bie_test/status/config"
+	cameraTopic := "homeassistant/sensor/bie_test/camera_Front_Door_state/config"
+	retained := waitRetained(t, broker,
+		"blueiris/status",
+		"blueiris/camera/Front_Door/state",
+		"blueiris/camera/Front_Door/triggers",
+		"blueiris/camera/Front_Door/last_object/attributes",
+		serverTopic,
+		cameraTopic,
+	)
+
+	for topic, want := range map[string]string{
+		"blueiris/status":                     "online",
+		"blueiris/camera/Front_Door/state":    "no_signal",
+		"blueiris/camera/Front_Door/triggers": "3",
+	} {
+		if retained[topic] != want {
+			t.Errorf("%v is %q, want %q", topic, retained[topic], want)
+		}
+	}
+
+	var attributes map[string]interface{}
+	err = json.Unmarshal([]byte(retained["blueiris/camera/Front_Door/last_object/attributes"]), &attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes["confidence"] != 87.0 || attributes["duration_ms"] != 123.0 {
+		t.Errorf("last object attributes %v, want the confidence and duration as numbers", attributes)
+	}
+
+	// The camera refers to the server device, which is discovered before any
+	// folder was seen.
+	var serverConfig, cameraConfig struct {
+		StateTopic        string `json:"state_topic"`
+		AvailabilityTopic string `json:"availability_topic"`
+		UniqueID          string `json:"unique_id"`
+		PayloadOn         string `json:"payload_on"`
+		Device            struct {
+			Identifiers []string `json:"identifiers"`
+			ViaDevice   string   `json:"via_device"`
+		} `json:"device"`
+	}
+	err = json.Unmarshal([]byte(retained[serverTopic]), &serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal([]byte(retained[cameraTopic]), &cameraConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverConfig.StateTopic != "blueiris/status" || serverConfig.PayloadOn != "online" || serverConfig.AvailabilityTopic != "" {
+		t.Errorf("unexpected server discovery config %+v", serverConfig)
+	}
+	if len(serverConfig.Device.Identifiers) != 1 || cameraConfig.Device.ViaDevice != serverConfig.Device.Identifiers[0] {
+		t.Errorf("camera via_device %q doesn't match the server device %v", cameraConfig.Device.ViaDevice, serverConfig.Device.Identifiers)
+	}
+	if cameraConfig.StateTopic != "blueiris/camera/Front_Door/state" || cameraConfig.AvailabilityTopic != "blueiris/status" || cameraConfig.UniqueID != "bie_test_camera_Front_Door_state" {
+		t.Errorf("unexpected camera discovery config %+v", cameraConfig)
+	}
+
+	// A broker restarted without persistence gets all the topics again.
+	broker.Close()
+	broker = startBroker(t, addr)
+	defer broker.Close()
+	retained = waitRetained(t, broker, "blueiris/status", "blueiris/camera/Front_Door/state", serverTopic, cameraTopic)
+	if retained["blueiris/camera/Front_Door/state"] != "no_signal" {
+		t.Errorf("state after reconnecting is %q, want no_signal", retained["blueiris/camera/Front_Door/state"])
+	}
+}
@@ -0,0 +1,131 @@
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/config"
+	promBridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+// counts are the metrics that only ever count up but are gauges for
+// Prometheus, to keep existing dashboards working. They are exported as
+// monotonic sums.
+var counts = map[string]bool{
+	"blueiris_ai_count":           true,
+	"blueiris_ai_restarted":       true,
+	"blueiris_ai_timeout":         true,
+	"blueiris_ai_servererror":     true,
+	"blueiris_ai_notresponding":   true,
+	"blueiris_ai_starting":        true,
+	"blueiris_ai_started":         true,
+	"blueiris_ai_error":           true,
+	"blueiris_logerror":           true,
+	"blueiris_logerror_total":     true,
+	"blueiris_logwarning":         true,
+	"blueiris_logwarning_total":   true,
+	"blueiris_triggers":           true,
+	"blueiris_push_notifications": true,
+	"blueiris_parse_errors":       true,
+	"blueiris_parse_errors_total": true,
+}
+
+// Start exports the metrics of the gatherer over OTLP every interval. The
+// Prometheus labels become attributes and the resource identifies the Blue
+// Iris server. Shutting down the returned provider exports the last interval.
+func Start(c config.OTLP, gatherer prometheus.Gatherer) (*sdkmetric.MeterProvider, error) {
+	ctx := context.Background()
+
+	exporter, err := newExporter(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	attributes := []attribute.KeyValue{
+		attribute.String("service.name", "blueiris_exporter"),
+		attribute.String("service.instance.id", hostname),
+		attribute.String("host.name", hostname),
+		attribute.String("blueiris.server", hostname),
+	}
+	for k, v := range c.ResourceAttributes {
+		attributes = append(attributes, attribute.String(k, v))
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(attributes...))
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP resource: %v", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(c.Interval), sdkmetric.WithProducer(newProducer(gatherer)))
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res)), nil
+}
+
+func newExporter(ctx context.Context, c config.OTLP) (sdkmetric.Exporter, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.Protocol == "http" {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpointURL(c.Endpoint),
+			otlpmetrichttp.WithHeaders(c.RequestHeaders()),
+			otlpmetrichttp.WithTimeout(c.Timeout),
+		}
+		if c.InsecureSkipVerify {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpointURL(c.Endpoint),
+		otlpmetricgrpc.WithHeaders(c.RequestHeaders()),
+		otlpmetricgrpc.WithTimeout(c.Timeout),
+	}
+	if c.InsecureSkipVerify {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
+
+type producer struct {
+	next  sdkmetric.Producer
+	start time.Time
+}
+
+func newProducer(gatherer prometheus.Gatherer) *producer {
+	return &producer{
+		next:  promBridge.NewMetricProducer(promBridge.WithGatherer(gatherer)),
+		start: time.Now(),
+	}
+}
+
+func (p *producer) Produce(ctx context.Context) ([]metricdata.ScopeMetrics, error) {
+	scopes, err := p.next.Produce(ctx)
+	for i := range scopes {
+		for j := range scopes[i].Metrics {
+			m := &scopes[i].Metrics[j]
+			g, ok := m.Data.(metricdata.Gauge[float64])
+			if !ok || !counts[m.Name] {
+				continue
+			}
+			for k := range g.DataPoints {
+				g.DataPoints[k].StartTime = p.start
+			}
+			m.Data = metricdata.Sum[float64]{
+				DataPoints:  g.DataPoints,
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+			}
+		}
+	}
+	return scopes, err
+}
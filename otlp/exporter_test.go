@@ -0,0 +1,127 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/config"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func newRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+
+	triggers := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "blueiris_triggers", Help: "Count of triggers"}, []string{"camera"})
+	triggers.WithLabelValues("FrontDoor").Set(3)
+	folder := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "blueiris_folder_disk_free", Help: "Free space"}, []string{"folder"})
+	folder.WithLabelValues("New").Set(1.4e12)
+	profile := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "blueiris_profile", Help: "Profiles"}, []string{"profile"})
+	profile.WithLabelValues("2").Set(1)
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "blueiris_ai_duration_seconds", Help: "AI durations", Buckets: []float64{0.1, 1}}, []string{"camera", "type", "ai_provider", "model"})
+	durations.WithLabelValues("FrontDoor", "alert", "codeproject", "Objects").Observe(0.123)
+
+	reg.MustRegister(triggers, folder, profile, durations)
+	return reg
+}
+
+func TestProducer(t *testing.T) {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithProducer(newProducer(newRegistry())))
+	sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	var rm metricdata.ResourceMetrics
+	err := reader.Collect(context.Background(), &rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+
+	hasAttribute := func(set attribute.Set, key string, value string) bool {
+		v, ok := set.Value(attribute.Key(key))
+		return ok && v.AsString() == value
+	}
+
+	// Counts that are gauges for Prometheus become monotonic sums.
+	sum, ok := metrics["blueiris_triggers"].Data.(metricdata.Sum[float64])
+	if !ok {
+		t.Fatalf("blueiris_triggers is %T, want a sum", metrics["blueiris_triggers"].Data)
+	}
+	if !sum.IsMonotonic || sum.Temporality != metricdata.CumulativeTemporality || len(sum.DataPoints) != 1 {
+		t.Errorf("blueiris_triggers is not a cumulative monotonic sum: %+v", sum)
+	} else if dp := sum.DataPoints[0]; dp.Value != 3 || dp.StartTime.IsZero() || !hasAttribute(dp.Attributes, "camera", "FrontDoor") {
+		t.Errorf("unexpected blueiris_triggers data point %+v", dp)
+	}
+
+	// Other gauges stay gauges, with their labels as attributes.
+	for name, label := range map[string][2]string{
+		"blueiris_folder_disk_free": {"folder", "New"},
+		"blueiris_profile":          {"profile", "2"},
+	} {
+		g, ok := metrics[name].Data.(metricdata.Gauge[float64])
+		if !ok || len(g.DataPoints) != 1 {
+			t.Errorf("%v is %T, want a gauge", name, metrics[name].Data)
+			continue
+		}
+		if !hasAttribute(g.DataPoints[0].Attributes, label[0], label[1]) {
+			t.Errorf("%v has attributes %v, want %v=%v", name, g.DataPoints[0].Attributes, label[0], label[1])
+		}
+	}
+
+	h, ok := metrics["blueiris_ai_duration_seconds"].Data.(metricdata.Histogram[float64])
+	if !ok || len(h.DataPoints) != 1 {
+		t.Fatalf("blueiris_ai_duration_seconds is %T, want a histogram", metrics["blueiris_ai_duration_seconds"].Data)
+	}
+	dp := h.DataPoints[0]
+	if dp.Count != 1 || dp.Sum != 0.123 || len(dp.Bounds) != 2 {
+		t.Errorf("unexpected blueiris_ai_duration_seconds data point %+v", dp)
+	}
+	for k, v := range map[string]string{"camera": "FrontDoor", "type": "alert", "ai_provider": "codeproject", "model": "Objects"} {
+		if !hasAttribute(dp.Attributes, k, v) {
+			t.Errorf("blueiris_ai_duration_seconds has attributes %v, want %v=%v", dp.Attributes, k, v)
+		}
+	}
+}
+
+func TestShutdownExports(t *testing.T) {
+	requests := make(chan []byte, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer s.Close()
+
+	provider, err := Start(config.OTLP{
+		Protocol:   "http",
+		Endpoint:   s.URL + "/v1/metrics",
+		Interval:   time.Hour,
+		HTTPClient: config.HTTPClient{Timeout: 5 * time.Second},
+	}, newRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The interval never passes, shutting down exports what there is.
+	err = provider.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-requests:
+		if len(body) == 0 {
+			t.Error("empty export")
+		}
+	default:
+		t.Error("nothing exported on shutdown")
+	}
+}
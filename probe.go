@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/wymangr/blueiris_exporter/blueirisapi"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func probeHandler(c *config.Config, clients *blueirisapi.Clients) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		target := params.Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		moduleName := params.Get("module")
+		if moduleName == "" {
+			moduleName = "default"
+		}
+		module, ok := c.Modules[moduleName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), module.Timeout)
+		defer cancel()
+
+		start := time.Now()
+		collector := blueirisapi.NewCollector(clients.Get(target, moduleName, module))
+		success := 1.0
+		err := collector.Update(ctx)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Probe of %v failed. Error: %v", target, err), "console")
+			success = 0
+		}
+		duration := time.Since(start).Seconds()
+
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: "probe_success", Help: "Whether the Blue Iris API probe succeeded"}, func() float64 { return success }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: "probe_duration_seconds", Help: "Duration of the Blue Iris API probe in seconds"}, func() float64 { return duration }),
+			collector,
+		)
+
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
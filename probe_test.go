@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueirisapi"
+	"github.com/wymangr/blueiris_exporter/blueirisapi/apitest"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func probe(t *testing.T, c *config.Config, query url.Values) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	probeHandler(c, blueirisapi.NewClients()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/probe?"+query.Encode(), nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	return w.Code, string(body)
+}
+
+func TestProbe(t *testing.T) {
+	s, _ := apitest.NewServer(t, "success")
+	c := &config.Config{Modules: map[string]config.Module{
+		"default": {Username: apitest.Username, Password: apitest.Password, Scheme: "http", Timeout: time.Second},
+		"wrong":   {Username: apitest.Username, Password: "wrong", Scheme: "http", Timeout: time.Second},
+	}}
+
+	tests := []struct {
+		query url.Values
+		code  int
+		want  []string
+	}{
+		{url.Values{}, http.StatusBadRequest, []string{"target parameter is missing"}},
+		{url.Values{"target": {s.URL}, "module": {"other"}}, http.StatusBadRequest, []string{`unknown module "other"`}},
+		{url.Values{"target": {s.URL}}, http.StatusOK, []string{
+			"blueiris_probe_success 1",
+			"blueiris_api_up 1",
+			`blueiris_api_camera_online{camera="Front"} 1`,
+			`blueiris_api_request_duration_seconds_count{cmd="camlist"} 1`,
+		}},
+		{url.Values{"target": {s.URL}, "module": {"wrong"}}, http.StatusOK, []string{
+			"blueiris_probe_success 0",
+			"blueiris_api_up 0",
+			"blueiris_api_login_failures_total 1",
+		}},
+	}
+
+	for _, tt := range tests {
+		code, body := probe(t, c, tt.query)
+		if code != tt.code {
+			t.Errorf("%v: status %v, want %v", tt.query.Encode(), code, tt.code)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(body, w) {
+				t.Errorf("%v: %q missing from\n%v", tt.query.Encode(), w, body)
+			}
+		}
+	}
+}
+
+func TestProbeNoDefaultModule(t *testing.T) {
+	c := &config.Config{Modules: map[string]config.Module{"nvr": {Scheme: "http", Timeout: time.Second}}}
+	code, body := probe(t, c, url.Values{"target": {"localhost:81"}})
+	if code != http.StatusBadRequest || !strings.Contains(body, `unknown module "default"`) {
+		t.Errorf("got %v %q, want the missing default module", code, body)
+	}
+}
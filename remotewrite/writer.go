@@ -0,0 +1,194 @@
+package remotewrite
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+// Writer gathers a registry on an interval and pushes it to Prometheus
+// remote_write endpoints.
+type Writer struct {
+	gatherer  prometheus.Gatherer
+	interval  time.Duration
+	labels    map[string]string
+	endpoints []*endpoint
+
+	requests    *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+	samples     *prometheus.CounterVec
+	dropped     *prometheus.CounterVec
+	queueLength *prometheus.GaugeVec
+	lastSuccess *prometheus.GaugeVec
+}
+
+type endpoint struct {
+	name   string
+	url    string
+	client *http.Client
+	queue  chan batch
+}
+
+type batch struct {
+	data    []byte
+	samples int
+}
+
+func NewWriter(c config.RemoteWrite, gatherer prometheus.Gatherer) *Writer {
+	labels := map[string]string{"job": "blueiris_exporter"}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["instance"] = hostname
+	}
+	for k, v := range c.ExternalLabels {
+		labels[k] = v
+	}
+
+	endpointLabels := []string{"endpoint"}
+	w := &Writer{
+		gatherer: gatherer,
+		interval: c.Interval,
+		labels:   labels,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remote_write_requests_total",
+			Help:      "Count of remote_write requests",
+		}, endpointLabels),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remote_write_failures_total",
+			Help:      "Count of failed remote_write requests",
+		}, endpointLabels),
+		samples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remote_write_samples_total",
+			Help:      "Count of samples sent with remote_write",
+		}, endpointLabels),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remote_write_dropped_batches_total",
+			Help:      "Count of batches dropped because the remote_write queue was full or the endpoint rejected them",
+		}, endpointLabels),
+		queueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "remote_write_queue_length",
+			Help:      "Count of batches waiting to be sent with remote_write",
+		}, endpointLabels),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "remote_write_last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful remote_write request",
+		}, endpointLabels),
+	}
+
+	for _, e := range c.Endpoints {
+		w.endpoints = append(w.endpoints, &endpoint{
+			name:   e.Name,
+			url:    e.URL,
+			client: e.HTTPClient.NewClient(),
+			queue:  make(chan batch, e.QueueSize),
+		})
+	}
+	return w
+}
+
+func (w *Writer) Run() {
+	for _, e := range w.endpoints {
+		go w.send(e)
+	}
+	for {
+		w.write()
+		time.Sleep(w.interval)
+	}
+}
+
+func (w *Writer) write() {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("Remote write - Error gathering metrics. Error: %v", err), "console")
+	}
+
+	data, samples := encode(families, w.labels, time.Now().UnixMilli())
+	b := batch{data: snappy.Encode(nil, data), samples: samples}
+	for _, e := range w.endpoints {
+		w.enqueue(e, b)
+	}
+}
+
+// enqueue adds a batch to the endpoint's queue, dropping the oldest batch if
+// the queue is full.
+func (w *Writer) enqueue(e *endpoint, b batch) {
+	for {
+		select {
+		case e.queue <- b:
+			return
+		default:
+		}
+		select {
+		case <-e.queue:
+			w.dropped.WithLabelValues(e.name).Inc()
+		default:
+		}
+	}
+}
+
+// send pushes the queued batches to an endpoint in order. A batch is retried
+// with backoff until it is accepted or rejected with a 4xx status.
+func (w *Writer) send(e *endpoint) {
+	for b := range e.queue {
+		err := config.Retry(-1, func() (bool, error) {
+			w.requests.WithLabelValues(e.name).Inc()
+			return w.post(e, b)
+		}, func(err error) {
+			w.failures.WithLabelValues(e.name).Inc()
+			common.BIlogger(fmt.Sprintf("Remote write - Error sending to %v. Error: %v", e.name, err), "console")
+		})
+		if err != nil {
+			w.dropped.WithLabelValues(e.name).Inc()
+			continue
+		}
+		w.samples.WithLabelValues(e.name).Add(float64(b.samples))
+		w.lastSuccess.WithLabelValues(e.name).SetToCurrentTime()
+	}
+}
+
+func (w *Writer) post(e *endpoint, b batch) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(b.data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "blueiris_exporter")
+	return config.Send(e.client, req)
+}
+
+func (w *Writer) Describe(ch chan<- *prometheus.Desc) {
+	w.requests.Describe(ch)
+	w.failures.Describe(ch)
+	w.samples.Describe(ch)
+	w.dropped.Describe(ch)
+	w.queueLength.Describe(ch)
+	w.lastSuccess.Describe(ch)
+}
+
+func (w *Writer) Collect(ch chan<- prometheus.Metric) {
+	for _, e := range w.endpoints {
+		w.queueLength.WithLabelValues(e.name).Set(float64(len(e.queue)))
+	}
+	w.requests.Collect(ch)
+	w.failures.Collect(ch)
+	w.samples.Collect(ch)
+	w.dropped.Collect(ch)
+	w.queueLength.Collect(ch)
+	w.lastSuccess.Collect(ch)
+}
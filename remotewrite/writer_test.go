@@ -0,0 +1,283 @@
+package remotewrite
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wymangr/blueiris_exporter/config"
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type sample struct {
+	labels map[string]string
+	value  float64
+	ts     int64
+}
+
+// decode parses a snappy compressed WriteRequest, independently of encode.
+func decode(t *testing.T, body []byte) []sample {
+	t.Helper()
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var samples []sample
+	for len(data) > 0 {
+		series := consumeBytes(t, &data, 1)
+		s := sample{labels: make(map[string]string)}
+		for len(series) > 0 {
+			num, typ, n := protowire.ConsumeTag(series)
+			if n < 0 || typ != protowire.BytesType {
+				t.Fatalf("invalid time series field %v", num)
+			}
+			field := consumeBytes(t, &series, num)
+			switch num {
+			case 1:
+				name := consumeBytes(t, &field, 1)
+				value := consumeBytes(t, &field, 2)
+				s.labels[string(name)] = string(value)
+			case 2:
+				num, _, n := protowire.ConsumeTag(field)
+				bits, m := protowire.ConsumeFixed64(field[n:])
+				if num != 1 || m < 0 {
+					t.Fatal("invalid sample value")
+				}
+				field = field[n+m:]
+				num, _, n = protowire.ConsumeTag(field)
+				ts, m := protowire.ConsumeVarint(field[n:])
+				if num != 2 || m < 0 {
+					t.Fatal("invalid sample timestamp")
+				}
+				s.value = math.Float64frombits(bits)
+				s.ts = int64(ts)
+			default:
+				t.Fatalf("unexpected time series field %v", num)
+			}
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+func consumeBytes(t *testing.T, b *[]byte, want protowire.Number) []byte {
+	t.Helper()
+	num, typ, n := protowire.ConsumeTag(*b)
+	if n < 0 || num != want || typ != protowire.BytesType {
+		t.Fatalf("expected bytes field %v, got %v", want, num)
+	}
+	v, m := protowire.ConsumeBytes((*b)[n:])
+	if m < 0 {
+		t.Fatalf("invalid bytes field %v", want)
+	}
+	*b = (*b)[n+m:]
+	return v
+}
+
+func find(samples []sample, labels map[string]string) *sample {
+	for i, s := range samples {
+		if len(s.labels) != len(labels) {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if s.labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return &samples[i]
+		}
+	}
+	return nil
+}
+
+type request struct {
+	header  http.Header
+	samples []sample
+}
+
+func newTestWriter(url string, queueSize int, gatherer prometheus.Gatherer) *Writer {
+	return NewWriter(config.RemoteWrite{
+		Interval:       time.Minute,
+		ExternalLabels: map[string]string{"instance": "nvr", "site": "home"},
+		Endpoints: []config.RemoteWriteEndpoint{{
+			Name:      "test",
+			URL:       url,
+			QueueSize: queueSize,
+			HTTPClient: config.HTTPClient{
+				BasicAuth: &config.BasicAuth{Username: "user", Password: "secret"},
+				Headers:   map[string]string{"X-Scope-OrgID": "blueiris"},
+				Timeout:   5 * time.Second,
+			},
+		}},
+	}, gatherer)
+}
+
+// next returns the next request with its samples decoded.
+func next(t *testing.T, requests chan configtest.Request) request {
+	t.Helper()
+	r := configtest.Next(t, requests)
+	return request{header: r.Header, samples: decode(t, r.Body)}
+}
+
+func TestWriter(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	triggers := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "blueiris_triggers", Help: "h"}, []string{"camera"})
+	triggers.WithLabelValues("Front Door").Add(3)
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "blueiris_ai_duration", Help: "h", Buckets: []float64{0.5, 1}})
+	duration.Observe(0.7)
+	instance := prometheus.NewGauge(prometheus.GaugeOpts{Name: "blueiris_info", Help: "h", ConstLabels: prometheus.Labels{"instance": "server"}})
+	instance.Set(1)
+	reg.MustRegister(triggers, duration, instance)
+
+	receiver, requests := configtest.NewServer(t)
+	w := newTestWriter(receiver.URL, 10, reg)
+	e := w.endpoints[0]
+	go w.send(e)
+	defer close(e.queue)
+
+	before := time.Now().UnixMilli()
+	w.write()
+	after := time.Now().UnixMilli()
+	r := next(t, requests)
+
+	for k, want := range map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"X-Scope-Orgid":                     "blueiris",
+	} {
+		if got := r.header.Get(k); got != want {
+			t.Errorf("header %v is %q, want %q", k, got, want)
+		}
+	}
+	if user, password, ok := (&http.Request{Header: r.header}).BasicAuth(); !ok || user != "user" || password != "secret" {
+		t.Errorf("basic auth %q:%q, want user:secret", user, password)
+	}
+
+	if len(r.samples) != 7 {
+		t.Errorf("got %v samples, want 7: %v", len(r.samples), r.samples)
+	}
+	for _, want := range []struct {
+		labels map[string]string
+		value  float64
+	}{
+		{map[string]string{"__name__": "blueiris_triggers", "camera": "Front Door", "instance": "nvr", "job": "blueiris_exporter", "site": "home"}, 3},
+		{map[string]string{"__name__": "blueiris_ai_duration_bucket", "le": "0.5", "instance": "nvr", "job": "blueiris_exporter", "site": "home"}, 0},
+		{map[string]string{"__name__": "blueiris_ai_duration_bucket", "le": "1", "instance": "nvr", "job": "blueiris_exporter", "site": "home"}, 1},
+		{map[string]string{"__name__": "blueiris_ai_duration_bucket", "le": "+Inf", "instance": "nvr", "job": "blueiris_exporter", "site": "home"}, 1},
+		{map[string]string{"__name__": "blueiris_ai_duration_sum", "instance": "nvr", "job": "blueiris_exporter", "site": "home"}, 0.7},
+		{map[string]string{"__name__": "blueiris_ai_duration_count", "instance": "nvr", "job": "blueiris_exporter", "site": "home"}, 1},
+		// The metric's own label wins over the external one.
+		{map[string]string{"__name__": "blueiris_info", "instance": "server", "job": "blueiris_exporter", "site": "home"}, 1},
+	} {
+		s := find(r.samples, want.labels)
+		if s == nil {
+			t.Errorf("no series %v in %v", want.labels, r.samples)
+			continue
+		}
+		if s.value != want.value {
+			t.Errorf("%v is %v, want %v", want.labels, s.value, want.value)
+		}
+		if s.ts < before || s.ts > after {
+			t.Errorf("%v has timestamp %v, want between %v and %v", want.labels, s.ts, before, after)
+		}
+	}
+
+	configtest.WaitFor(t, w.samples.WithLabelValues("test"), 7)
+}
+
+// timestamped is a collector with a sample that has its own timestamp.
+type timestamped struct {
+	t time.Time
+}
+
+var timestampedDesc = prometheus.NewDesc("blueiris_last_event", "h", nil, nil)
+
+func (c timestamped) Describe(ch chan<- *prometheus.Desc) {
+	ch <- timestampedDesc
+}
+
+func (c timestamped) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.NewMetricWithTimestamp(c.t, prometheus.MustNewConstMetric(timestampedDesc, prometheus.GaugeValue, 5))
+}
+
+func TestWriterTimestamp(t *testing.T) {
+	stamped := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(timestamped{stamped})
+
+	receiver, requests := configtest.NewServer(t)
+	w := newTestWriter(receiver.URL, 10, reg)
+	go w.send(w.endpoints[0])
+	defer close(w.endpoints[0].queue)
+
+	w.write()
+	r := next(t, requests)
+	s := find(r.samples, map[string]string{"__name__": "blueiris_last_event", "instance": "nvr", "job": "blueiris_exporter", "site": "home"})
+	if s == nil || s.value != 5 || s.ts != stamped.UnixMilli() {
+		t.Errorf("got %+v, want value 5 at %v", s, stamped.UnixMilli())
+	}
+}
+
+func TestWriterRetry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	receiver, requests := configtest.NewServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadRequest)
+	w := newTestWriter(receiver.URL, 10, reg)
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "blueiris_batch", Help: "h"})
+	reg.MustRegister(gauge)
+	e := w.endpoints[0]
+
+	// 503 and 429 are retried with the same batch, the 400 drops it and the
+	// next batch is sent.
+	gauge.Set(1)
+	w.write()
+	gauge.Set(2)
+	w.write()
+	go w.send(e)
+	defer close(e.queue)
+
+	want := []float64{1, 1, 1, 2}
+	for i, v := range want {
+		r := next(t, requests)
+		if len(r.samples) != 1 || r.samples[0].value != v {
+			t.Errorf("request %v has %v, want batch %v", i, r.samples, v)
+		}
+	}
+
+	configtest.WaitFor(t, w.samples.WithLabelValues("test"), 1)
+	configtest.WaitFor(t, w.requests.WithLabelValues("test"), 4)
+	configtest.WaitFor(t, w.failures.WithLabelValues("test"), 3)
+	configtest.WaitFor(t, w.dropped.WithLabelValues("test"), 1)
+}
+
+func TestWriterDropOldest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "blueiris_batch", Help: "h"})
+	reg.MustRegister(gauge)
+	w := newTestWriter("http://127.0.0.1:1", 2, reg)
+	e := w.endpoints[0]
+
+	for i := 1; i <= 3; i++ {
+		gauge.Set(float64(i))
+		w.write()
+	}
+
+	if d := testutil.ToFloat64(w.dropped.WithLabelValues("test")); d != 1 {
+		t.Errorf("%v batches dropped, want 1", d)
+	}
+	for _, want := range []float64{2, 3} {
+		b := <-e.queue
+		samples := decode(t, b.data)
+		if len(samples) != 1 || samples[0].value != want || b.samples != 1 {
+			t.Errorf("queued batch %v, want %v", samples, want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package statsd
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+var (
+	nameEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", " ", "_", "\n", "_")
+	tagEscaper  = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+)
+
+// Emitter sends the log events as StatsD metrics over UDP. With DogStatsD
+// the camera, object and other details are sent as tags, plain StatsD has no
+// tags so they are left out.
+type Emitter struct {
+	address       string
+	prefix        string
+	dogStatsD     bool
+	tags          []string
+	sampleRate    float64
+	flushInterval time.Duration
+	maxPacketSize int
+	events        chan blueiris.Event
+
+	conn    net.Conn
+	packet  []byte
+	metrics int
+
+	sent     prometheus.Counter
+	failures prometheus.Counter
+	failed   prometheus.Counter
+	dropped  prometheus.Counter
+}
+
+func NewEmitter(c config.StatsD) *Emitter {
+	return &Emitter{
+		address:       c.Address,
+		prefix:        c.Prefix,
+		dogStatsD:     c.DogStatsD,
+		tags:          c.Tags,
+		sampleRate:    c.SampleRate,
+		flushInterval: c.FlushInterval,
+		maxPacketSize: c.MaxPacketSize,
+		events:        make(chan blueiris.Event, 1000),
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "statsd_metrics_total",
+			Help:      "Count of metrics sent to StatsD",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "statsd_send_failures_total",
+			Help:      "Count of StatsD packets that could not be sent",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "statsd_failed_metrics_total",
+			Help:      "Count of metrics in the StatsD packets that could not be sent",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "statsd_dropped_events_total",
+			Help:      "Count of events dropped because the queue was full",
+		}),
+	}
+}
+
+// Handle queues an event for sending, it is meant to be registered with
+// blueiris.AddEventHandler.
+func (e *Emitter) Handle(ev blueiris.Event) {
+	if ev.Type == blueiris.EventLog {
+		return
+	}
+	select {
+	case e.events <- ev:
+	default:
+		e.dropped.Inc()
+	}
+}
+
+func (e *Emitter) Run() {
+	ticker := time.NewTicker(e.flushInterval)
+	for {
+		select {
+		case ev := <-e.events:
+			e.emit(ev)
+		case <-ticker.C:
+			e.flush()
+		}
+	}
+}
+
+// emit turns an event into metrics. Counters and timings are not sent for
+// the events from the log file that was already there at startup, those
+// were counted before the exporter restarted.
+func (e *Emitter) emit(ev blueiris.Event) {
+	switch ev.Type {
+	case blueiris.EventTrigger:
+		if !ev.Replay {
+			e.metric("triggers", "1", "c", true, "camera:"+ev.Camera, "source:"+ev.Detail)
+		}
+	case blueiris.EventAI:
+		if ev.Replay {
+			return
+		}
+		tags := []string{"camera:" + ev.Camera, "object:" + ev.Object, "ai_provider:" + ev.Provider, "model:" + ev.Model}
+		if ev.Result == "canceled" {
+			e.metric("ai.canceled", "1", "c", true, tags...)
+		} else {
+			e.metric("ai.alerts", "1", "c", true, tags...)
+		}
+		e.metric("ai.duration", formatFloat(ev.Duration), "ms", true, append(tags, "type:"+ev.Result)...)
+	case blueiris.EventAIStatus:
+		if !ev.Replay {
+			e.metric("ai.events", "1", "c", true, "ai_provider:"+ev.Provider, "event:"+ev.Result)
+		}
+	case blueiris.EventError:
+		if !ev.Replay {
+			e.metric("errors", "1", "c", true)
+		}
+	case blueiris.EventWarning:
+		if !ev.Replay {
+			e.metric("warnings", "1", "c", true)
+		}
+	case blueiris.EventParseError:
+		if !ev.Replay {
+			e.metric("parse_errors", "1", "c", true)
+		}
+	case blueiris.EventCameraState:
+		up := "0"
+		if ev.State == blueiris.CameraUp {
+			up = "1"
+		}
+		e.metric("camera.up", up, "g", false, "camera:"+ev.Camera)
+	case blueiris.EventFolder:
+		e.metric("folder.disk_free_bytes", formatFloat(ev.DiskFree), "g", false, "folder:"+ev.Folder)
+		e.metric("folder.used_percent", formatFloat(ev.FolderUsed), "g", false, "folder:"+ev.Folder)
+		e.metric("folder.hours_used_percent", formatFloat(ev.HoursUsed), "g", false, "folder:"+ev.Folder)
+	}
+}
+
+// metric adds a metric to the packet, it is counted as sent once the packet
+// was written. Sampled metrics are only sent for sample_rate of the calls,
+// with the rate so the server can scale them up.
+func (e *Emitter) metric(name string, value string, kind string, sampled bool, tags ...string) {
+	line := nameEscaper.Replace(e.prefix+name) + ":" + value + "|" + kind
+	if sampled && e.sampleRate < 1 {
+		if rand.Float64() >= e.sampleRate {
+			return
+		}
+		line += "|@" + strconv.FormatFloat(e.sampleRate, 'f', -1, 64)
+	}
+	if e.dogStatsD {
+		t := make([]string, 0, len(e.tags)+len(tags))
+		for _, tag := range e.tags {
+			t = append(t, tagEscaper.Replace(tag))
+		}
+		for _, tag := range tags {
+			if !strings.HasSuffix(tag, ":") {
+				t = append(t, tagEscaper.Replace(tag))
+			}
+		}
+		if len(t) > 0 {
+			line += "|#" + strings.Join(t, ",")
+		}
+	}
+
+	if len(e.packet) > 0 && len(e.packet)+1+len(line) > e.maxPacketSize {
+		e.flush()
+	}
+	if len(e.packet) > 0 {
+		e.packet = append(e.packet, '\n')
+	}
+	e.packet = append(e.packet, line...)
+	e.metrics++
+}
+
+func (e *Emitter) flush() {
+	if len(e.packet) == 0 {
+		return
+	}
+	defer func() {
+		e.packet = e.packet[:0]
+		e.metrics = 0
+	}()
+
+	if e.conn == nil {
+		conn, err := net.Dial("udp", e.address)
+		if err != nil {
+			e.failures.Inc()
+			e.failed.Add(float64(e.metrics))
+			common.BIlogger(fmt.Sprintf("StatsD - Error connecting to %v. Error: %v", e.address, err), "console")
+			return
+		}
+		e.conn = conn
+	}
+	_, err := e.conn.Write(e.packet)
+	if err != nil {
+		e.failures.Inc()
+		e.failed.Add(float64(e.metrics))
+		common.BIlogger(fmt.Sprintf("StatsD - Error sending to %v. Error: %v", e.address, err), "console")
+		e.conn.Close()
+		e.conn = nil
+		return
+	}
+	e.sent.Add(float64(e.metrics))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (e *Emitter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.sent.Desc()
+	ch <- e.failures.Desc()
+	ch <- e.failed.Desc()
+	ch <- e.dropped.Desc()
+}
+
+func (e *Emitter) Collect(ch chan<- prometheus.Metric) {
+	ch <- e.sent
+	ch <- e.failures
+	ch <- e.failed
+	ch <- e.dropped
+}
@@ -0,0 +1,135 @@
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+func listen(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func newTestEmitter(address string, dogStatsD bool, maxPacketSize int) *Emitter {
+	return NewEmitter(config.StatsD{
+		Address:       address,
+		Prefix:        "bi.",
+		DogStatsD:     dogStatsD,
+		Tags:          []string{"env:home"},
+		SampleRate:    1,
+		FlushInterval: time.Second,
+		MaxPacketSize: maxPacketSize,
+	})
+}
+
+var events = []blueiris.Event{
+	{Type: blueiris.EventTrigger, Camera: "Front Door", Detail: "MOTION"},
+	{Type: blueiris.EventAI, Camera: "Drive,Left", Object: "person", Provider: "CodeProject.AI", Result: "alert", Duration: 123.5},
+	{Type: blueiris.EventCameraState, Camera: "Gate", State: blueiris.CameraNoSignal},
+	{Type: blueiris.EventTrigger, Camera: "Old", Replay: true},
+}
+
+func TestEmitterDogStatsD(t *testing.T) {
+	conn := listen(t)
+	e := newTestEmitter(conn.LocalAddr().String(), true, 1432)
+	for _, ev := range events {
+		e.emit(ev)
+	}
+	if s := testutil.ToFloat64(e.sent); s != 0 {
+		t.Errorf("%v metrics counted as sent before the packet was written", s)
+	}
+	e.flush()
+
+	got := receive(t, conn)
+	want := []string{
+		"bi.triggers:1|c|#env:home,camera:Front Door,source:MOTION",
+		"bi.ai.alerts:1|c|#env:home,camera:Drive_Left,object:person,ai_provider:CodeProject.AI",
+		"bi.ai.duration:123.5|ms|#env:home,camera:Drive_Left,object:person,ai_provider:CodeProject.AI,type:alert",
+		"bi.camera.up:0|g|#env:home,camera:Gate",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if s := testutil.ToFloat64(e.sent); s != 4 {
+		t.Errorf("%v metrics counted as sent, want 4", s)
+	}
+}
+
+func TestEmitterPlain(t *testing.T) {
+	conn := listen(t)
+	e := newTestEmitter(conn.LocalAddr().String(), false, 1432)
+	e.prefix = "blue iris:"
+	e.emit(events[0])
+	e.emit(events[1])
+	e.flush()
+
+	got := receive(t, conn)
+	want := []string{
+		"blue_iris_triggers:1|c",
+		"blue_iris_ai.alerts:1|c",
+		"blue_iris_ai.duration:123.5|ms",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEmitterPacketSize(t *testing.T) {
+	conn := listen(t)
+	e := newTestEmitter(conn.LocalAddr().String(), false, 40)
+	e.emit(events[0])
+	e.emit(events[1])
+	e.flush()
+
+	// Lines that don't fit go into the next packet.
+	for _, want := range []string{"bi.triggers:1|c\nbi.ai.alerts:1|c", "bi.ai.duration:123.5|ms"} {
+		if got := strings.Join(receive(t, conn), "\n"); got != want {
+			t.Errorf("packet %q, want %q", got, want)
+		}
+	}
+	if s := testutil.ToFloat64(e.sent); s != 3 {
+		t.Errorf("%v metrics counted as sent, want 3", s)
+	}
+}
+
+func TestEmitterFailure(t *testing.T) {
+	e := newTestEmitter("127.0.0.1:notaport", true, 1432)
+	e.emit(events[0])
+	e.emit(events[1])
+	e.flush()
+
+	if s := testutil.ToFloat64(e.sent); s != 0 {
+		t.Errorf("%v metrics counted as sent, want none", s)
+	}
+	if f := testutil.ToFloat64(e.failures); f != 1 {
+		t.Errorf("%v failed packets, want 1", f)
+	}
+	if f := testutil.ToFloat64(e.failed); f != 3 {
+		t.Errorf("%v failed metrics, want 3", f)
+	}
+	if len(e.packet) != 0 || e.metrics != 0 {
+		t.Errorf("packet not reset after the failure")
+	}
+}
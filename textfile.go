@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/wymangr/blueiris_exporter/common"
+)
+
+// runTextfile writes the metrics to path every interval, for the textfile
+// collector of windows_exporter or node_exporter.
+func runTextfile(gatherer prometheus.Gatherer, path string, interval time.Duration) {
+	for {
+		err := writeTextfile(gatherer, path)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Textfile - Error writing %v. Error: %v", path, err), "error")
+		}
+		time.Sleep(interval)
+	}
+}
+
+// writeTextfile writes to a temporary file in the same directory and renames
+// it over path, so the collector never reads a partial file.
+func writeTextfile(gatherer prometheus.Gatherer, path string) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		common.BIlogger(fmt.Sprintf("Textfile - Error gathering metrics. Error: %v", err), "console")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, mf := range families {
+		_, err = expfmt.MetricFamilyToText(tmp, mf)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
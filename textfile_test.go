@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// stepGatherer waits for the test before every Gather, so the test can look
+// at the file between the writes.
+type stepGatherer struct {
+	prometheus.Gatherer
+	calls   chan struct{}
+	proceed chan struct{}
+}
+
+func (g stepGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.calls <- struct{}{}
+	<-g.proceed
+	return g.Gatherer.Gather()
+}
+
+func readTextfile(t *testing.T, f *os.File) float64 {
+	t.Helper()
+	_, err := f.Seek(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, ok := families["blueiris_triggers"]
+	if !ok || len(mf.GetMetric()) != 1 {
+		t.Fatalf("got %v, want blueiris_triggers", families)
+	}
+	return mf.GetMetric()[0].GetCounter().GetValue()
+}
+
+func TestRunTextfile(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	triggers := prometheus.NewCounter(prometheus.CounterOpts{Name: "blueiris_triggers", Help: "h"})
+	reg.MustRegister(triggers)
+	g := stepGatherer{Gatherer: reg, calls: make(chan struct{}), proceed: make(chan struct{})}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blueiris.prom")
+	// The goroutine stays blocked in the last Gather, so it doesn't write
+	// after the test.
+	go runTextfile(g, path, 10*time.Millisecond)
+
+	files := func() []string {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+	step := func() {
+		t.Helper()
+		select {
+		case <-g.calls:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the metrics weren't gathered")
+		}
+	}
+
+	step()
+	triggers.Inc()
+	g.proceed <- struct{}{}
+	step()
+
+	if names := files(); len(names) != 1 || names[0] != "blueiris.prom" {
+		t.Errorf("got %v, want only the textfile", names)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode is %v, want 0644", info.Mode().Perm())
+	}
+	first, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if v := readTextfile(t, first); v != 1 {
+		t.Errorf("got %v triggers, want 1", v)
+	}
+	// Windows doesn't rename over an open file.
+	if runtime.GOOS == "windows" {
+		first.Close()
+	}
+
+	triggers.Inc()
+	g.proceed <- struct{}{}
+	step()
+
+	second, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if v := readTextfile(t, second); v != 2 {
+		t.Errorf("got %v triggers, want 2", v)
+	}
+	// The new file is renamed over the old one, which keeps what was
+	// written before, rather than written in place.
+	if runtime.GOOS != "windows" {
+		if v := readTextfile(t, first); v != 1 {
+			t.Errorf("the old file has %v triggers, want 1", v)
+		}
+	}
+	if names := files(); len(names) != 1 {
+		t.Errorf("got %v, want the temporary file removed", names)
+	}
+}
+
+func TestWriteTextfileMissingDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "blueiris.prom")
+	if err := writeTextfile(prometheus.NewRegistry(), path); err == nil {
+		t.Error("no error writing to a missing directory")
+	}
+}
@@ -0,0 +1,281 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/common"
+	"github.com/wymangr/blueiris_exporter/config"
+)
+
+var namespace string = "blueiris"
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// Notifier calls the configured webhooks for the events that match them.
+// Each webhook has its own queue, so a slow or failing webhook doesn't hold
+// up the others.
+type Notifier struct {
+	hooks []*hook
+
+	sent        *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+	rateLimited *prometheus.CounterVec
+	dropped     *prometheus.CounterVec
+}
+
+type hook struct {
+	name          string
+	url           string
+	method        string
+	client        *http.Client
+	types         map[string]bool
+	filter        map[string]*regexp.Regexp
+	when          *template.Template
+	body          *template.Template
+	rateLimit     time.Duration
+	rateLimitKey  *template.Template
+	retries       int
+	includeReplay bool
+	events        chan blueiris.Event
+
+	lastSent map[string]time.Time
+}
+
+func NewNotifier(c []config.Webhook) (*Notifier, error) {
+	hookLabels := []string{"webhook"}
+	n := &Notifier{
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_sent_total",
+			Help:      "Count of webhook notifications sent",
+		}, hookLabels),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_failures_total",
+			Help:      "Count of failed webhook requests",
+		}, hookLabels),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_rate_limited_total",
+			Help:      "Count of webhook notifications skipped by the rate limit",
+		}, hookLabels),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_dropped_total",
+			Help:      "Count of webhook notifications dropped because the queue was full or all retries failed",
+		}, hookLabels),
+	}
+
+	for _, w := range c {
+		h := &hook{
+			name:          w.Name,
+			url:           w.URL,
+			method:        w.Method,
+			client:        w.HTTPClient.NewClient(),
+			types:         make(map[string]bool),
+			filter:        make(map[string]*regexp.Regexp),
+			rateLimit:     w.RateLimit,
+			retries:       *w.Retries,
+			includeReplay: w.IncludeReplay,
+			events:        make(chan blueiris.Event, 100),
+			lastSent:      make(map[string]time.Time),
+		}
+		for _, t := range w.Events {
+			h.types[t] = true
+		}
+		for field, expr := range w.Filter {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("webhook %v: error parsing filter %v: %v", w.Name, field, err)
+			}
+			h.filter[field] = re
+		}
+
+		var err error
+		if w.When != "" {
+			h.when, err = template.New("when").Funcs(funcs).Parse(w.When)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %v: error parsing when: %v", w.Name, err)
+			}
+		}
+		if w.Body != "" {
+			h.body, err = template.New("body").Funcs(funcs).Parse(w.Body)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %v: error parsing body: %v", w.Name, err)
+			}
+		}
+		h.rateLimitKey, err = template.New("rate_limit_key").Funcs(funcs).Parse(w.RateLimitKey)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %v: error parsing rate_limit_key: %v", w.Name, err)
+		}
+
+		n.sent.WithLabelValues(h.name)
+		n.failures.WithLabelValues(h.name)
+		n.rateLimited.WithLabelValues(h.name)
+		n.dropped.WithLabelValues(h.name)
+		n.hooks = append(n.hooks, h)
+	}
+	return n, nil
+}
+
+// Handle queues an event for every webhook, it is meant to be registered
+// with blueiris.AddEventHandler.
+func (n *Notifier) Handle(e blueiris.Event) {
+	if e.Type == blueiris.EventLog {
+		return
+	}
+	for _, h := range n.hooks {
+		if e.Replay && !h.includeReplay {
+			continue
+		}
+		if len(h.types) > 0 && !h.types[e.Type] {
+			continue
+		}
+		select {
+		case h.events <- e:
+		default:
+			n.dropped.WithLabelValues(h.name).Inc()
+		}
+	}
+}
+
+func (n *Notifier) Run() {
+	for _, h := range n.hooks {
+		go n.run(h)
+	}
+}
+
+func (n *Notifier) run(h *hook) {
+	for e := range h.events {
+		ok, err := h.match(e)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Webhook %v - Error matching event. Error: %v", h.name, err), "console")
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if h.rateLimit > 0 {
+			key, err := render(h.rateLimitKey, e)
+			if err != nil {
+				common.BIlogger(fmt.Sprintf("Webhook %v - Error rendering rate_limit_key. Error: %v", h.name, err), "console")
+				continue
+			}
+			if time.Since(h.lastSent[key]) < h.rateLimit {
+				n.rateLimited.WithLabelValues(h.name).Inc()
+				continue
+			}
+			h.lastSent[key] = time.Now()
+		}
+
+		body, err := h.render(e)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Webhook %v - Error rendering body. Error: %v", h.name, err), "console")
+			n.dropped.WithLabelValues(h.name).Inc()
+			continue
+		}
+		n.send(h, body)
+	}
+}
+
+// match reports whether the event passes the filter and when template of the
+// webhook. Filters match the JSON fields of the event.
+func (h *hook) match(e blueiris.Event) (bool, error) {
+	if len(h.filter) > 0 {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return false, err
+		}
+		fields := make(map[string]interface{})
+		err = json.Unmarshal(b, &fields)
+		if err != nil {
+			return false, err
+		}
+		for field, re := range h.filter {
+			value := ""
+			if v, ok := fields[field]; ok {
+				value = fmt.Sprint(v)
+			}
+			if !re.MatchString(value) {
+				return false, nil
+			}
+		}
+	}
+
+	if h.when == nil {
+		return true, nil
+	}
+	out, err := render(h.when, e)
+	if err != nil {
+		return false, err
+	}
+	return out == "true", nil
+}
+
+func (h *hook) render(e blueiris.Event) ([]byte, error) {
+	if h.body == nil {
+		return json.Marshal(e)
+	}
+	var b bytes.Buffer
+	err := h.body.Execute(&b, e)
+	return b.Bytes(), err
+}
+
+func render(t *template.Template, e blueiris.Event) (string, error) {
+	var b strings.Builder
+	err := t.Execute(&b, e)
+	return strings.TrimSpace(b.String()), err
+}
+
+// send makes the request, retrying with backoff after network errors, 5xx
+// and 429 responses.
+func (n *Notifier) send(h *hook, body []byte) {
+	err := config.Retry(h.retries, func() (bool, error) {
+		req, err := http.NewRequest(h.method, h.url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "blueiris_exporter")
+		return config.Send(h.client, req)
+	}, func(err error) {
+		n.failures.WithLabelValues(h.name).Inc()
+		common.BIlogger(fmt.Sprintf("Webhook %v - Error sending notification. Error: %v", h.name, err), "console")
+	})
+	if err != nil {
+		n.dropped.WithLabelValues(h.name).Inc()
+		return
+	}
+	n.sent.WithLabelValues(h.name).Inc()
+}
+
+func (n *Notifier) Describe(ch chan<- *prometheus.Desc) {
+	n.sent.Describe(ch)
+	n.failures.Describe(ch)
+	n.rateLimited.Describe(ch)
+	n.dropped.Describe(ch)
+}
+
+func (n *Notifier) Collect(ch chan<- prometheus.Metric) {
+	n.sent.Collect(ch)
+	n.failures.Collect(ch)
+	n.rateLimited.Collect(ch)
+	n.dropped.Collect(ch)
+}
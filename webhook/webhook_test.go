@@ -0,0 +1,163 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/wymangr/blueiris_exporter/blueiris"
+	"github.com/wymangr/blueiris_exporter/config"
+	"github.com/wymangr/blueiris_exporter/config/configtest"
+)
+
+// newTestNotifier starts a notifier with the defaults config sets for the
+// webhooks.
+func newTestNotifier(t *testing.T, hooks ...config.Webhook) *Notifier {
+	t.Helper()
+	for i := range hooks {
+		hooks[i].Method = "POST"
+		if hooks[i].RateLimitKey == "" {
+			hooks[i].RateLimitKey = "{{ .Type }}|{{ .Camera }}|{{ .Provider }}|{{ .Folder }}|{{ .State }}|{{ .Result }}"
+		}
+		if hooks[i].Retries == nil {
+			retries := 1
+			hooks[i].Retries = &retries
+		}
+		hooks[i].HTTPClient.Timeout = 5 * time.Second
+	}
+	n, err := NewNotifier(hooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Run()
+	return n
+}
+
+var at = time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+
+func TestWebhookFilter(t *testing.T) {
+	server, requests := configtest.NewServer(t)
+	n := newTestNotifier(t, config.Webhook{
+		Name:   "ntfy",
+		URL:    server.URL + "/blueiris",
+		Events: []string{blueiris.EventCameraState},
+		Filter: map[string]string{"state": "no_signal|up"},
+		Body:   "{{ .Camera }} is {{ .State }} ({{ .Detail }})",
+		HTTPClient: config.HTTPClient{
+			Headers: map[string]string{"Title": "Blue Iris"},
+		},
+	})
+
+	n.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Drive"})
+	n.Handle(blueiris.Event{Type: blueiris.EventCameraState, Time: at, Camera: "Drive", State: blueiris.CameraUnknown})
+	n.Handle(blueiris.Event{Type: blueiris.EventCameraState, Time: at, Camera: "Drive", State: blueiris.CameraNoSignal, Detail: "network", Replay: true})
+	n.Handle(blueiris.Event{Type: blueiris.EventCameraState, Time: at, Camera: "Drive", State: blueiris.CameraNoSignal, Detail: "network"})
+
+	// Only the event of the type that matches the filter and wasn't
+	// replayed is sent.
+	r := configtest.Next(t, requests)
+	if r.Method != http.MethodPost || r.URL.Path != "/blueiris" {
+		t.Errorf("unexpected request %v %v", r.Method, r.URL)
+	}
+	for k, want := range map[string]string{"Content-Type": "application/json", "User-Agent": "blueiris_exporter", "Title": "Blue Iris"} {
+		if got := r.Header.Get(k); got != want {
+			t.Errorf("header %v is %q, want %q", k, got, want)
+		}
+	}
+	if want := "Drive is no_signal (network)"; string(r.Body) != want {
+		t.Errorf("body is %q, want %q", r.Body, want)
+	}
+	configtest.None(t, requests)
+	configtest.WaitFor(t, n.sent.WithLabelValues("ntfy"), 1)
+}
+
+func TestWebhookWhen(t *testing.T) {
+	server, requests := configtest.NewServer(t)
+	n := newTestNotifier(t,
+		config.Webhook{
+			Name:   "discord",
+			URL:    server.URL + "/discord",
+			Events: []string{blueiris.EventFolder},
+			When:   "{{ gt .FolderUsed 90.0 }}",
+			Body:   `{"content": {{ printf "Folder %v is %.1f%% full" .Folder .FolderUsed | json }}}`,
+		},
+		config.Webhook{
+			Name:   "json",
+			URL:    server.URL + "/json",
+			Events: []string{blueiris.EventParseError},
+			When:   "{{ eq .Count 1.0 }}",
+		},
+	)
+
+	n.Handle(blueiris.Event{Type: blueiris.EventFolder, Time: at, Folder: "New", FolderUsed: 80})
+	n.Handle(blueiris.Event{Type: blueiris.EventFolder, Time: at, Folder: "New", FolderUsed: 95.04})
+	r := configtest.Next(t, requests)
+	if want := `{"content": "Folder New is 95.0% full"}`; r.URL.Path != "/discord" || string(r.Body) != want {
+		t.Errorf("got %v %q, want %q", r.URL.Path, r.Body, want)
+	}
+	configtest.None(t, requests)
+
+	// Without a body the event is sent as JSON.
+	n.Handle(blueiris.Event{Type: blueiris.EventParseError, Time: at, Count: 1, Line: "bad line"})
+	n.Handle(blueiris.Event{Type: blueiris.EventParseError, Time: at, Count: 2, Line: "bad line"})
+	r = configtest.Next(t, requests)
+	var e blueiris.Event
+	err := json.Unmarshal(r.Body, &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.URL.Path != "/json" || e.Type != blueiris.EventParseError || !e.Time.Equal(at) || e.Count != 1 || e.Line != "bad line" {
+		t.Errorf("got %v %+v, want the first parse error", r.URL.Path, e)
+	}
+	configtest.None(t, requests)
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	server, requests := configtest.NewServer(t)
+	n := newTestNotifier(t, config.Webhook{
+		Name:         "limited",
+		URL:          server.URL,
+		RateLimit:    time.Hour,
+		RateLimitKey: "{{ .Camera }}",
+	})
+
+	for _, camera := range []string{"Drive", "Drive", "Gate", "Drive"} {
+		n.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: camera})
+	}
+
+	// Every camera is sent once an hour.
+	for _, want := range []string{"Drive", "Gate"} {
+		var e blueiris.Event
+		err := json.Unmarshal(configtest.Next(t, requests).Body, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Camera != want {
+			t.Errorf("got %v, want %v", e.Camera, want)
+		}
+	}
+	configtest.None(t, requests)
+	configtest.WaitFor(t, n.rateLimited.WithLabelValues("limited"), 2)
+}
+
+func TestWebhookRetry(t *testing.T) {
+	server, requests := configtest.NewServer(t, http.StatusServiceUnavailable, http.StatusNoContent, http.StatusBadRequest, http.StatusInternalServerError, http.StatusTooManyRequests)
+	n := newTestNotifier(t, config.Webhook{Name: "retry", URL: server.URL, Body: "{{ .Camera }}"})
+
+	n.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Drive"})
+	n.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Gate"})
+	n.Handle(blueiris.Event{Type: blueiris.EventTrigger, Time: at, Camera: "Porch"})
+
+	// The 503 is retried, the 400 isn't and the 429 is the last of the
+	// retries.
+	for _, want := range []string{"Drive", "Drive", "Gate", "Porch", "Porch"} {
+		if r := configtest.Next(t, requests); string(r.Body) != want {
+			t.Errorf("got %q, want %q", r.Body, want)
+		}
+	}
+	configtest.None(t, requests)
+	configtest.WaitFor(t, n.sent.WithLabelValues("retry"), 1)
+	configtest.WaitFor(t, n.failures.WithLabelValues("retry"), 4)
+	configtest.WaitFor(t, n.dropped.WithLabelValues("retry"), 2)
+}
@@ -15,7 +15,9 @@ import (
 	"golang.org/x/sys/windows/svc/mgr"
 )
 
-type myservice struct{}
+type myservice struct {
+	opts options
+}
 
 func (m *myservice) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
 
@@ -29,10 +31,15 @@ func (m *myservice) Execute(args []string, r <-chan svc.ChangeRequest, changes c
 	var a string = fmt.Sprintf(`starting Blue Iris Exporter with the following:
 		Log Path: %v
 		Metric Path: %v
-		Port: %v`, os.Args[1], os.Args[2], os.Args[3])
+		Port: %v`, m.opts.logpath, m.opts.metricsPath, m.opts.port)
 	common.BIlogger(a, "info")
 
-	go start(os.Args[1], os.Args[2], os.Args[3])
+	go func() {
+		err := start(m.opts)
+		if err != nil {
+			common.BIlogger(fmt.Sprintf("Error starting blueiris_exporter. err: %v", err), "error")
+		}
+	}()
 loop:
 	for {
 		select {
@@ -57,25 +64,26 @@ loop:
 		}
 	}
 	changes <- svc.Status{State: svc.StopPending}
+	stop()
 	return
 }
 
-func IsService(name string) error {
+func IsService(name string, opts options) (bool, error) {
 
 	inService, err := svc.IsWindowsService()
 	if err != nil {
-		return err
+		return false, err
 	}
 	if inService {
 		run := svc.Run
-		err = run(name, &myservice{})
+		err = run(name, &myservice{opts: opts})
 		if err != nil {
 			common.BIlogger(fmt.Sprintf("%s service failed: %v", name, err), "error")
-			return err
+			return true, err
 		}
 	}
 
-	return nil
+	return inService, nil
 }
 
 func exePath() (string, error) {
@@ -107,7 +115,7 @@ func exePath() (string, error) {
 	return "", err
 }
 
-func installService(name, desc string, logpath string, metricsPath string, port string) error {
+func installService(name, desc string, args []string) error {
 	exepath, err := exePath()
 	if err != nil {
 		return err
@@ -122,7 +130,7 @@ func installService(name, desc string, logpath string, metricsPath string, port
 		s.Close()
 		return fmt.Errorf("service %s already exists", name)
 	}
-	s, err = m.CreateService(name, exepath, mgr.Config{DisplayName: desc}, logpath, metricsPath, port)
+	s, err = m.CreateService(name, exepath, mgr.Config{DisplayName: desc}, args...)
 	if err != nil {
 		return err
 	}